@@ -0,0 +1,72 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/laincloud/deployd/engine"
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulConfigs struct {
+	server.BaseResource
+}
+
+func (rc RestfulConfigs) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	name := form.ParamString(r, "name", "")
+	if name == "" {
+		return http.StatusOK, getEngine(ctx).GetConfigs(namespace)
+	}
+	if config, ok := getEngine(ctx).GetConfig(namespace, name); !ok {
+		return http.StatusNotFound, fmt.Sprintf("No config found for %s/%s", namespace, name)
+	} else {
+		return http.StatusOK, config
+	}
+}
+
+func (rc RestfulConfigs) Patch(ctx context.Context, r *http.Request) (int, interface{}) {
+	var config engine.ConfigSpec
+	if err := form.ParamBodyJson(r, &config); err != nil {
+		return http.StatusBadRequest, fmt.Sprintf("Bad parameter format for ConfigSpec, %s", err)
+	}
+	if !config.VerifyParams() {
+		return http.StatusBadRequest, "namespace, name and data required, the name and the file names should be [A-Za-z0-9_.-]"
+	}
+
+	if err := getEngine(ctx).UpdateConfig(config); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Config will be patched, the pod groups mounting it will be restarted",
+		"check_url": urlReverser.Reverse("Get_RestfulConfigs") + "?namespace=" + config.Namespace + "&name=" + config.Name,
+	}
+}
+
+func (rc RestfulConfigs) Delete(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	name := form.ParamString(r, "name", "")
+	if namespace == "" || name == "" {
+		return http.StatusBadRequest, "namespace and name required"
+	}
+
+	if err := getEngine(ctx).DeleteConfig(namespace, name); err != nil {
+		switch err {
+		case engine.ErrConfigNotExists:
+			return http.StatusNotFound, err.Error()
+		case engine.ErrConfigInUse:
+			return http.StatusMethodNotAllowed, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Config will be deleted from the orc engine.",
+		"check_url": urlReverser.Reverse("Get_RestfulConfigs") + "?namespace=" + namespace,
+	}
+}
@@ -39,7 +39,8 @@ func (rdp RestfulDependPods) Delete(ctx context.Context, r *http.Request) (int,
 	}
 	force := form.ParamBoolean(r, "force", false)
 	orcEngine := getEngine(ctx)
-	if err := orcEngine.RemoveDependencyPod(dpName, force); err != nil {
+	opId, err := orcEngine.RemoveDependencyPod(dpName, force)
+	if err != nil {
 		if err == engine.ErrDependencyPodNotExists {
 			return http.StatusNotFound, err.Error()
 		}
@@ -47,8 +48,10 @@ func (rdp RestfulDependPods) Delete(ctx context.Context, r *http.Request) (int,
 	}
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "Dependency pod will be removed from the orc engine.",
-		"check_url": urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + dpName,
+		"message":       "Dependency pod will be removed from the orc engine.",
+		"check_url":     urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + dpName,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
 	}
 }
 
@@ -62,16 +65,22 @@ func (rdp RestfulDependPods) Put(ctx context.Context, r *http.Request) (int, int
 	}
 
 	orcEngine := getEngine(ctx)
-	if err := orcEngine.UpdateDependencyPod(podSpec); err != nil {
+	opId, err := orcEngine.UpdateDependencyPod(podSpec)
+	if err != nil {
 		if err == engine.ErrDependencyPodNotExists {
 			return http.StatusNotFound, err.Error()
 		}
+		if err == engine.ErrConfigNotExists {
+			return http.StatusMethodNotAllowed, err.Error()
+		}
 		return http.StatusInternalServerError, err.Error()
 	}
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "Dependency PodSpec would be updated in orc engine.",
-		"check_url": urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + podSpec.Name,
+		"message":       "Dependency PodSpec would be updated in orc engine.",
+		"check_url":     urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + podSpec.Name,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
 	}
 }
 
@@ -86,15 +95,44 @@ func (rdp RestfulDependPods) Post(ctx context.Context, r *http.Request) (int, in
 	}
 
 	orcEngine := getEngine(ctx)
-	if err := orcEngine.NewDependencyPod(podSpec); err != nil {
-		if err == engine.ErrDependencyPodExists {
+	opId, err := orcEngine.NewDependencyPod(podSpec)
+	if err != nil {
+		if err == engine.ErrDependencyPodExists || err == engine.ErrConfigNotExists {
 			return http.StatusMethodNotAllowed, err.Error()
 		}
 		return http.StatusInternalServerError, err.Error()
 	}
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "Dependency pod will be added into orc engine.",
-		"check_url": urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + podSpec.Name,
+		"message":       "Dependency pod will be added into orc engine.",
+		"check_url":     urlReverser.Reverse("Get_RestfulDependPods") + "?name=" + podSpec.Name,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
+	}
+}
+
+type RestfulDependPodPlan struct {
+	server.BaseResource
+}
+
+func (rdpp RestfulDependPodPlan) Post(ctx context.Context, r *http.Request) (int, interface{}) {
+	var podSpec engine.PodSpec
+	if err := form.ParamBodyJson(r, &podSpec); err != nil {
+		return http.StatusBadRequest, fmt.Sprintf("Bad parameter format for PodSpec, %s", err)
+	}
+	if !podSpec.VerifyParams() {
+		return http.StatusBadRequest, fmt.Sprintf("Missing parameters for PodSpec")
+	}
+
+	plan, err := getEngine(ctx).PlanDependencyPod(podSpec)
+	if err != nil {
+		if err == engine.ErrDependencyPodNotExists {
+			return http.StatusNotFound, err.Error()
+		}
+		if err == engine.ErrConfigNotExists {
+			return http.StatusMethodNotAllowed, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
 	}
+	return http.StatusOK, plan
 }
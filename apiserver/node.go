@@ -39,14 +39,15 @@ func (rn RestfulNodes) Patch(ctx context.Context, r *http.Request) (int, interfa
 	switch cmd {
 	case "drift":
 		engine := getEngine(ctx)
-		engine.DriftNode(fromNode, targetNode, pgName, pgInstance, forceDrift)
+		opIds := engine.DriftNode(fromNode, targetNode, pgName, pgInstance, forceDrift)
 		return http.StatusAccepted, map[string]interface{}{
-			"message":    "PodGroups will be drifting",
-			"from":       fromNode,
-			"to":         targetNode,
-			"pgName":     pgName,
-			"pgInstance": pgInstance,
-			"forceDrift": forceDrift,
+			"message":       "PodGroups will be drifting",
+			"from":          fromNode,
+			"to":            targetNode,
+			"pgName":        pgName,
+			"pgInstance":    pgInstance,
+			"forceDrift":    forceDrift,
+			"operation_ids": opIds,
 		}
 	default:
 		return http.StatusBadRequest, fmt.Sprintf("Unkown command %s", cmd)
@@ -0,0 +1,26 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulOperations struct {
+	server.BaseResource
+}
+
+func (ro RestfulOperations) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	opId := form.ParamString(r, "id", "")
+	if opId == "" {
+		return http.StatusBadRequest, fmt.Sprintf("No operation id provided.")
+	}
+	op, ok := getEngine(ctx).GetOperation(opId)
+	if !ok {
+		return http.StatusNotFound, fmt.Sprintf("No such operation id=%s", opId)
+	}
+	return http.StatusOK, op
+}
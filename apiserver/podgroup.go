@@ -26,9 +26,17 @@ func (rpg RestfulPodGroups) Post(ctx context.Context, r *http.Request) (int, int
 	}
 
 	orcEngine := getEngine(ctx)
-	if err := orcEngine.NewPodGroup(pgSpec); err != nil {
+	opId, err := orcEngine.NewPodGroup(pgSpec)
+	if shortage, ok := err.(*engine.ResourceShortage); ok {
+		// the shortage explains the eligible nodes and the missing resources
+		return http.StatusMethodNotAllowed, shortage
+	}
+	if exceeded, ok := err.(*engine.QuotaExceeded); ok {
+		return http.StatusMethodNotAllowed, exceeded
+	}
+	if err != nil {
 		switch err {
-		case engine.ErrNotEnoughResources, engine.ErrPodGroupExists, engine.ErrDependencyPodNotExists:
+		case engine.ErrPodGroupExists, engine.ErrDependencyPodNotExists, engine.ErrConfigNotExists:
 			return http.StatusMethodNotAllowed, err.Error()
 		default:
 			return http.StatusInternalServerError, err.Error()
@@ -37,8 +45,10 @@ func (rpg RestfulPodGroups) Post(ctx context.Context, r *http.Request) (int, int
 
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "PodGroupSpec added into the orc engine.",
-		"check_url": urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgSpec.Name,
+		"message":       "PodGroupSpec added into the orc engine.",
+		"check_url":     urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgSpec.Name,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
 	}
 }
 
@@ -48,7 +58,8 @@ func (rpg RestfulPodGroups) Delete(ctx context.Context, r *http.Request) (int, i
 		return http.StatusBadRequest, fmt.Sprintf("No pod group name provided.")
 	}
 	orcEngine := getEngine(ctx)
-	if err := orcEngine.RemovePodGroup(pgName); err != nil {
+	opId, err := orcEngine.RemovePodGroup(pgName)
+	if err != nil {
 		if err == engine.ErrPodGroupNotExists {
 			return http.StatusNotFound, err.Error()
 		}
@@ -57,8 +68,10 @@ func (rpg RestfulPodGroups) Delete(ctx context.Context, r *http.Request) (int, i
 
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "PodGroupSpec will be deleted from the orc engine.",
-		"check_url": urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgName,
+		"message":       "PodGroupSpec will be deleted from the orc engine.",
+		"check_url":     urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgName,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
 	}
 }
 
@@ -92,9 +105,12 @@ func (rpg RestfulPodGroups) Patch(ctx context.Context, r *http.Request) (int, in
 	}
 
 	orcEngine := getEngine(ctx)
-	options := []string{"replica", "spec"}
+	options := []string{"replica", "spec", "canary", "promote", "abort", "rollback", "stop", "start", "pause", "resume", "recreate"}
 	cmd := form.ParamStringOptions(r, "cmd", options, "noop")
-	var err error
+	var (
+		opId string
+		err  error
+	)
 	switch cmd {
 	case "replica":
 		numInstance := form.ParamInt(r, "num_instances", -1)
@@ -112,9 +128,9 @@ func (rpg RestfulPodGroups) Patch(ctx context.Context, r *http.Request) (int, in
 			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for num_instances, should be > 0 but %d", numInstance)
 		}
 		if restartPolicy != -1 {
-			err = orcEngine.RescheduleInstance(pgName, numInstance, engine.RestartPolicy(restartPolicy))
+			opId, err = orcEngine.RescheduleInstance(pgName, numInstance, engine.RestartPolicy(restartPolicy))
 		} else {
-			err = orcEngine.RescheduleInstance(pgName, numInstance)
+			opId, err = orcEngine.RescheduleInstance(pgName, numInstance)
 		}
 	case "spec":
 		var podSpec engine.PodSpec
@@ -124,15 +140,69 @@ func (rpg RestfulPodGroups) Patch(ctx context.Context, r *http.Request) (int, in
 		if !podSpec.VerifyParams() {
 			return http.StatusBadRequest, fmt.Sprintf("Missing parameter for PodSpec")
 		}
-		err = orcEngine.RescheduleSpec(pgName, podSpec)
+		strategy, ok := paramRollingUpdateStrategy(r)
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for max_surge, max_unavailable or max_failed_instances, should be >= 0, or remove_delay, should be >= -1")
+		}
+		opId, err = orcEngine.RescheduleSpec(pgName, podSpec, strategy...)
+	case "canary":
+		var podSpec engine.PodSpec
+		if bodyErr := form.ParamBodyJson(r, &podSpec); bodyErr != nil {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter format for PodSpec, %s", bodyErr)
+		}
+		if !podSpec.VerifyParams() {
+			return http.StatusBadRequest, fmt.Sprintf("Missing parameter for PodSpec")
+		}
+		numInstance := form.ParamInt(r, "num_instances", -1)
+		if numInstance <= 0 {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for num_instances, should be > 0 but %d", numInstance)
+		}
+		opId, err = orcEngine.StartCanary(pgName, podSpec, numInstance)
+	case "rollback":
+		revision := form.ParamInt(r, "revision", -1)
+		if revision <= 0 {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for revision, should be > 0 but %d", revision)
+		}
+		opId, err = orcEngine.RollbackPodGroup(pgName, revision)
+	case "recreate":
+		instanceNo := form.ParamInt(r, "instance", -1)
+		if instanceNo <= 0 {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for instance, should be > 0 but %d", instanceNo)
+		}
+		opId, err = orcEngine.RecreateInstance(pgName, instanceNo)
+	case "stop":
+		opId, err = orcEngine.StopPodGroup(pgName)
+	case "start":
+		opId, err = orcEngine.StartPodGroup(pgName)
+	case "pause":
+		opId, err = orcEngine.PausePodGroup(pgName)
+	case "resume":
+		opId, err = orcEngine.ResumePodGroup(pgName)
+	case "promote":
+		opId, err = orcEngine.PromoteCanary(pgName)
+	case "abort":
+		opId, err = orcEngine.AbortCanary(pgName)
 	}
 
+	if shortage, ok := err.(*engine.ResourceShortage); ok {
+		// the shortage explains the eligible nodes and the missing resources
+		return http.StatusMethodNotAllowed, shortage
+	}
+	if exceeded, ok := err.(*engine.QuotaExceeded); ok {
+		return http.StatusMethodNotAllowed, exceeded
+	}
 	if err != nil {
 		switch err {
-		case engine.ErrPodGroupNotExists:
+		case engine.ErrPodGroupNotExists, engine.ErrRevisionNotExists, engine.ErrInstanceNotExists:
 			return http.StatusNotFound, err.Error()
-		case engine.ErrNotEnoughResources, engine.ErrDependencyPodNotExists:
+		case engine.ErrDependencyPodNotExists, engine.ErrConfigNotExists, engine.ErrConfigVersionNotExists:
+			return http.StatusMethodNotAllowed, err.Error()
+		case engine.ErrCanaryInProgress, engine.ErrCanaryNotExists, engine.ErrPodGroupStopped, engine.ErrPodGroupIsJob:
 			return http.StatusMethodNotAllowed, err.Error()
+		case engine.ErrPodGroupIsDaemon, engine.ErrInstanceRunning:
+			return http.StatusMethodNotAllowed, err.Error()
+		case engine.ErrCanaryInstancesInvalid, engine.ErrHostnameTooLong:
+			return http.StatusBadRequest, err.Error()
 		default:
 			return http.StatusInternalServerError, err.Error()
 		}
@@ -140,7 +210,82 @@ func (rpg RestfulPodGroups) Patch(ctx context.Context, r *http.Request) (int, in
 
 	urlReverser := getUrlReverser(ctx)
 	return http.StatusAccepted, map[string]string{
-		"message":   "PodGroupSpec will be patched and rescheduled.",
-		"check_url": urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgName,
+		"message":       "PodGroupSpec will be patched and rescheduled.",
+		"check_url":     urlReverser.Reverse("Get_RestfulPodGroups") + "?name=" + pgName,
+		"operation_id":  opId,
+		"operation_url": urlReverser.Reverse("Get_RestfulOperations") + "?id=" + opId,
+	}
+}
+
+// paramRollingUpdateStrategy returns the strategy if any of the rolling update parameters is given
+func paramRollingUpdateStrategy(r *http.Request) ([]engine.RollingUpdateStrategy, bool) {
+	if !form.ParamDefined(r, "max_surge") && !form.ParamDefined(r, "max_unavailable") &&
+		!form.ParamDefined(r, "max_failed_instances") && !form.ParamDefined(r, "remove_delay") {
+		return nil, true
+	}
+	strategy := engine.RollingUpdateStrategy{
+		MaxSurge:           form.ParamInt(r, "max_surge", 0),
+		MaxUnavailable:     form.ParamInt(r, "max_unavailable", 0),
+		MaxFailedInstances: form.ParamInt(r, "max_failed_instances", 0),
+		RemoveDelay:        form.ParamInt(r, "remove_delay", 0),
+	}
+	if !strategy.VerifyParams() {
+		return nil, false
+	}
+	return []engine.RollingUpdateStrategy{strategy}, true
+}
+
+type RestfulPodGroupPlan struct {
+	server.BaseResource
+}
+
+func (rpgp RestfulPodGroupPlan) Post(ctx context.Context, r *http.Request) (int, interface{}) {
+	pgName := form.ParamString(r, "name", "")
+	if pgName == "" {
+		return http.StatusBadRequest, fmt.Sprintf("No pod group name provided.")
+	}
+	var podSpec engine.PodSpec
+	if err := form.ParamBodyJson(r, &podSpec); err != nil {
+		return http.StatusBadRequest, fmt.Sprintf("Bad parameter format for PodSpec, %s", err)
+	}
+	if !podSpec.VerifyParams() {
+		return http.StatusBadRequest, fmt.Sprintf("Missing parameter for PodSpec")
+	}
+	strategy, ok := paramRollingUpdateStrategy(r)
+	if !ok {
+		return http.StatusBadRequest, fmt.Sprintf("Bad parameter for max_surge, max_unavailable or max_failed_instances, should be >= 0, or remove_delay, should be >= -1")
+	}
+
+	plan, err := getEngine(ctx).PlanPodGroupSpec(pgName, podSpec, strategy...)
+	if err != nil {
+		switch err {
+		case engine.ErrPodGroupNotExists:
+			return http.StatusNotFound, err.Error()
+		case engine.ErrCanaryInProgress, engine.ErrPodGroupStopped, engine.ErrConfigNotExists:
+			return http.StatusMethodNotAllowed, err.Error()
+		default:
+			return http.StatusInternalServerError, err.Error()
+		}
+	}
+	return http.StatusOK, plan
+}
+
+type RestfulPodGroupHistory struct {
+	server.BaseResource
+}
+
+func (rpgh RestfulPodGroupHistory) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	pgName := form.ParamString(r, "name", "")
+	if pgName == "" {
+		return http.StatusBadRequest, fmt.Sprintf("No pod group name provided.")
+	}
+
+	revisions, err := getEngine(ctx).PodGroupHistory(pgName)
+	if err != nil {
+		if err == engine.ErrPodGroupNotExists {
+			return http.StatusNotFound, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
 	}
+	return http.StatusOK, revisions
 }
@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/laincloud/deployd/engine"
+	"github.com/laincloud/deployd/utils/units"
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulQuotas struct {
+	server.BaseResource
+}
+
+func (rq RestfulQuotas) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	if namespace == "" {
+		return http.StatusOK, getEngine(ctx).GetQuotaUsages()
+	}
+	return http.StatusOK, getEngine(ctx).GetQuotaUsage(namespace)
+}
+
+func (rq RestfulQuotas) Patch(ctx context.Context, r *http.Request) (int, interface{}) {
+	quota := engine.QuotaSpec{
+		Namespace: form.ParamString(r, "namespace", ""),
+		Limit: engine.QuotaResources{
+			CPUs:      form.ParamInt(r, "cpus", 0),
+			Instances: form.ParamInt(r, "instances", 0),
+			PodGroups: form.ParamInt(r, "pod_groups", 0),
+		},
+	}
+	if memory := form.ParamString(r, "memory", ""); memory != "" {
+		if bytes, err := units.RAMInBytes(memory); err != nil {
+			return http.StatusBadRequest, fmt.Sprintf("Bad parameter for memory, %s", err)
+		} else {
+			quota.Limit.Memory = bytes
+		}
+	}
+	if !quota.VerifyParams() {
+		return http.StatusBadRequest, "namespace required and the limits should be >= 0"
+	}
+
+	if err := getEngine(ctx).UpdateQuota(quota); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Quota will be patched",
+		"check_url": urlReverser.Reverse("Get_RestfulQuotas") + "?namespace=" + quota.Namespace,
+	}
+}
+
+func (rq RestfulQuotas) Delete(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	if namespace == "" {
+		return http.StatusBadRequest, "namespace required"
+	}
+
+	if err := getEngine(ctx).DeleteQuota(namespace); err != nil {
+		if err == engine.ErrQuotaNotExists {
+			return http.StatusNotFound, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Quota will be deleted from the orc engine.",
+		"check_url": urlReverser.Reverse("Get_RestfulQuotas") + "?namespace=" + namespace,
+	}
+}
@@ -0,0 +1,76 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/laincloud/deployd/engine"
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulSecrets struct {
+	server.BaseResource
+}
+
+func (rs RestfulSecrets) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	name := form.ParamString(r, "name", "")
+	if name == "" {
+		return http.StatusOK, getEngine(ctx).GetSecrets(namespace)
+	}
+	if secret, ok := getEngine(ctx).GetSecret(namespace, name); !ok {
+		return http.StatusNotFound, fmt.Sprintf("No secret found for %s/%s", namespace, name)
+	} else {
+		return http.StatusOK, secret
+	}
+}
+
+// Patch creates or replaces the secret, the values are only accepted in the body so they never show in the urls
+func (rs RestfulSecrets) Patch(ctx context.Context, r *http.Request) (int, interface{}) {
+	var secret engine.SecretSpec
+	if err := form.ParamBodyJson(r, &secret); err != nil {
+		return http.StatusBadRequest, fmt.Sprintf("Bad parameter format for SecretSpec, %s", err)
+	}
+	if !secret.VerifyParams() {
+		return http.StatusBadRequest, "namespace, name and data required"
+	}
+
+	if err := getEngine(ctx).UpdateSecret(secret); err != nil {
+		if err == engine.ErrSecretKeyMissing {
+			return http.StatusMethodNotAllowed, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Secret will be patched",
+		"check_url": urlReverser.Reverse("Get_RestfulSecrets") + "?namespace=" + secret.Namespace + "&name=" + secret.Name,
+	}
+}
+
+func (rs RestfulSecrets) Delete(ctx context.Context, r *http.Request) (int, interface{}) {
+	namespace := form.ParamString(r, "namespace", "")
+	name := form.ParamString(r, "name", "")
+	if namespace == "" || name == "" {
+		return http.StatusBadRequest, "namespace and name required"
+	}
+
+	if err := getEngine(ctx).DeleteSecret(namespace, name); err != nil {
+		switch err {
+		case engine.ErrSecretNotExists:
+			return http.StatusNotFound, err.Error()
+		case engine.ErrSecretInUse:
+			return http.StatusMethodNotAllowed, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Secret will be deleted from the orc engine.",
+		"check_url": urlReverser.Reverse("Get_RestfulSecrets") + "?namespace=" + namespace,
+	}
+}
@@ -52,11 +52,20 @@ func (s *Server) ListenAndServe(addr string) error {
 
 	s.RestfulHandlerAdapter(s.adaptResourceHandler)
 	s.AddRestfulResource("/api/podgroups", "RestfulPodGroups", RestfulPodGroups{})
+	s.AddRestfulResource("/api/podgroups/history", "RestfulPodGroupHistory", RestfulPodGroupHistory{})
+	s.AddRestfulResource("/api/podgroups/plan", "RestfulPodGroupPlan", RestfulPodGroupPlan{})
 	s.AddRestfulResource("/api/depends", "RestfulDependPods", RestfulDependPods{})
+	s.AddRestfulResource("/api/depends/plan", "RestfulDependPodPlan", RestfulDependPodPlan{})
 	s.AddRestfulResource("/api/nodes", "RestfulNodes", RestfulNodes{})
+	s.AddRestfulResource("/api/nodes/topology", "RestfulNodeTopology", RestfulNodeTopology{})
 	s.AddRestfulResource("/api/status", "RestfulStatus", RestfulStatus{})
 	s.AddRestfulResource("/api/constraints", "RestfulConstraints", RestfulConstraints{})
+	s.AddRestfulResource("/api/quotas", "RestfulQuotas", RestfulQuotas{})
+	s.AddRestfulResource("/api/volumes", "RestfulVolumes", RestfulVolumes{})
+	s.AddRestfulResource("/api/secrets", "RestfulSecrets", RestfulSecrets{})
+	s.AddRestfulResource("/api/configs", "RestfulConfigs", RestfulConfigs{})
 	s.AddRestfulResource("/api/notifies", "RestfulNotifies", RestfulNotifies{})
+	s.AddRestfulResource("/api/operations", "RestfulOperations", RestfulOperations{})
 
 	s.Get("/debug/vars", "RuntimeStat", s.getRuntimeStat)
 	s.NotFound(func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
@@ -88,6 +97,9 @@ func (s *Server) adaptResourceHandler(handler server.ResourceHandler) server.Han
 			errMessage := ""
 			if msg, ok := data.(string); ok {
 				errMessage = msg
+			} else if err, ok := data.(error); ok {
+				// the error details are rendered as the data
+				errMessage = err.Error()
 			}
 			switch code {
 			case http.StatusMethodNotAllowed:
@@ -0,0 +1,68 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/laincloud/deployd/engine"
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulNodeTopology struct {
+	server.BaseResource
+}
+
+func (rt RestfulNodeTopology) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	node := form.ParamString(r, "node", "")
+	if node == "" {
+		return http.StatusOK, getEngine(ctx).GetNodeTopologies()
+	}
+	if topology, ok := getEngine(ctx).GetNodeTopology(node); !ok {
+		return http.StatusNotFound, fmt.Sprintf("No topology found for node %s", node)
+	} else {
+		return http.StatusOK, topology
+	}
+}
+
+func (rt RestfulNodeTopology) Patch(ctx context.Context, r *http.Request) (int, interface{}) {
+	topology := engine.NodeTopology{
+		Node: form.ParamString(r, "node", ""),
+		Zone: form.ParamString(r, "zone", ""),
+		Rack: form.ParamString(r, "rack", ""),
+	}
+	if !topology.VerifyParams() {
+		return http.StatusBadRequest, "node name and zone or rack required"
+	}
+
+	if err := getEngine(ctx).UpdateNodeTopology(topology); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Node topology will be patched",
+		"check_url": urlReverser.Reverse("Get_RestfulNodeTopology") + "?node=" + topology.Node,
+	}
+}
+
+func (rt RestfulNodeTopology) Delete(ctx context.Context, r *http.Request) (int, interface{}) {
+	node := form.ParamString(r, "node", "")
+	if node == "" {
+		return http.StatusBadRequest, "node name required"
+	}
+
+	if err := getEngine(ctx).DeleteNodeTopology(node); err != nil {
+		if err == engine.ErrNodeTopologyNotExists {
+			return http.StatusNotFound, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Node topology will be deleted from the orc engine.",
+		"check_url": urlReverser.Reverse("Get_RestfulNodeTopology") + "?node=" + node,
+	}
+}
@@ -0,0 +1,44 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/laincloud/deployd/engine"
+	"github.com/mijia/sweb/form"
+	"github.com/mijia/sweb/server"
+	"golang.org/x/net/context"
+)
+
+type RestfulVolumes struct {
+	server.BaseResource
+}
+
+func (rv RestfulVolumes) Get(ctx context.Context, r *http.Request) (int, interface{}) {
+	pgName := form.ParamString(r, "name", "")
+	return http.StatusOK, getEngine(ctx).GetVolumes(pgName)
+}
+
+func (rv RestfulVolumes) Delete(ctx context.Context, r *http.Request) (int, interface{}) {
+	pgName := form.ParamString(r, "name", "")
+	instanceNo := form.ParamInt(r, "instance", -1)
+	node := form.ParamString(r, "node", "")
+	if pgName == "" || instanceNo < 1 || node == "" {
+		return http.StatusBadRequest, "podgroup name, instance and node required"
+	}
+
+	if err := getEngine(ctx).CleanVolume(pgName, instanceNo, node); err != nil {
+		switch err {
+		case engine.ErrVolumeNotExists:
+			return http.StatusNotFound, err.Error()
+		case engine.ErrVolumeInUse:
+			return http.StatusMethodNotAllowed, err.Error()
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	urlReverser := getUrlReverser(ctx)
+	return http.StatusAccepted, map[string]string{
+		"message":   "Volume will be deleted",
+		"check_url": urlReverser.Reverse("Get_RestfulVolumes") + "?name=" + pgName,
+	}
+}
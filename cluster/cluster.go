@@ -1,6 +1,10 @@
 package cluster
 
-import "github.com/mijia/adoc"
+import (
+	"time"
+
+	"github.com/mijia/adoc"
+)
 
 type Node struct {
 	Name       string
@@ -10,6 +14,7 @@ type Node struct {
 	UsedCPUs   int
 	Memory     int64
 	UsedMemory int64
+	Labels     map[string]string // the engine labels of the node, nil if they are unknown
 }
 
 func (n Node) SpareCPUs() int {
@@ -32,6 +37,8 @@ type Cluster interface {
 	InspectContainer(id string) (adoc.ContainerDetail, error)
 	RemoveContainer(id string, force bool, volumes bool) error
 	RenameContainer(id string, name string) error
+	ExecContainer(id string, cmd []string, timeout time.Duration) (int, []byte, error)
+	CopyToContainer(id string, path string, archive []byte) error
 
 	MonitorEvents(filter string, callback adoc.EventCallback) int64
 	StopMonitor(monitorId int64)
@@ -1,7 +1,13 @@
 package swarm
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mijia/adoc"
@@ -10,26 +16,162 @@ import (
 
 type SwarmCluster struct {
 	*adoc.DockerClient
+
+	addr       string // the http address of the swarm master, for the apis adoc does not have
+	httpClient *http.Client
 }
 
 func (c *SwarmCluster) GetResources() ([]cluster.Node, error) {
-	if info, err := c.DockerClient.SwarmInfo(); err != nil {
+	info, err := c.DockerClient.Info()
+	if err != nil {
 		return nil, err
-	} else {
-		nodes := make([]cluster.Node, len(info.Nodes))
-		for i, node := range info.Nodes {
-			nodes[i] = cluster.Node{
-				Name:       node.Name,
-				Address:    node.Address,
-				Containers: node.Containers,
-				CPUs:       node.CPUs,
-				UsedCPUs:   node.UsedCPUs,
-				Memory:     node.Memory,
-				UsedMemory: node.UsedMemory,
+	}
+	return parseSwarmNodes(info.DriverStatus), nil
+}
+
+// parseSwarmNodes parses the nodes from the driver status of the swarm info. adoc expects exactly 5 lines for
+// every node and drops the labels, here a node starts with the line of its name and the address, and is followed
+// by its "└" lines, the unknown lines are skipped.
+func parseSwarmNodes(status [][2]string) []cluster.Node {
+	var nodes []cluster.Node
+	inNodes := false
+	for _, kv := range status {
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !inNodes {
+			inNodes = strings.HasSuffix(key, "Nodes")
+			continue
+		}
+		if !strings.HasPrefix(key, "└") {
+			nodes = append(nodes, cluster.Node{Name: key, Address: value, Labels: make(map[string]string)})
+			continue
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		node := &nodes[len(nodes)-1]
+		switch strings.TrimSpace(strings.TrimPrefix(key, "└")) {
+		case "Containers":
+			// e.g. "3" or "3 (2 Running, 0 Paused, 1 Stopped)"
+			if fields := strings.Fields(value); len(fields) > 0 {
+				node.Containers, _ = strconv.ParseInt(fields[0], 10, 64)
+			}
+		case "Reserved CPUs":
+			if used, total, ok := splitUsage(value); ok {
+				node.UsedCPUs, _ = strconv.Atoi(used)
+				node.CPUs, _ = strconv.Atoi(total)
+			}
+		case "Reserved Memory":
+			if used, total, ok := splitUsage(value); ok {
+				node.UsedMemory, _ = parseBytesSize(used)
+				node.Memory, _ = parseBytesSize(total)
 			}
+		case "Labels":
+			for _, label := range strings.Split(value, ", ") {
+				if parts := strings.SplitN(label, "=", 2); len(parts) == 2 {
+					node.Labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// splitUsage splits the reserved resources like "2 / 8" or "1 GiB / 7.8 GiB"
+func splitUsage(value string) (string, string, bool) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+func parseBytesSize(size string) (int64, error) {
+	if len(strings.Fields(size)) != 2 {
+		return 0, fmt.Errorf("Invalid size %q", size)
+	}
+	return adoc.ParseBytesSize(size)
+}
+
+// CopyToContainer extracts the tar archive into the path of the container, the container is not needed to be
+// running, so the files can be put into the created container before it is started. Swarm forwards the
+// request to the node of the container.
+func (c *SwarmCluster) CopyToContainer(id string, path string, archive []byte) error {
+	urlPath := fmt.Sprintf("%s/containers/%s/archive?path=%s", c.addr, id, url.QueryEscape(path))
+	req, err := http.NewRequest("PUT", urlPath, bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return adoc.Error{StatusCode: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+const (
+	kExecExitCodeMarker = "__deployd_exec_exit_code__:"
+	kExecTimeoutGrace   = 5 * time.Second
+)
+
+// ExecContainer runs the command inside the container and returns the exit code and the output,
+// docker api here has no exec inspect, so the command is wrapped by sh to print the exit code.
+// Docker cannot kill an exec either, the wrapper runs the command in its own process group and kills
+// the whole group once the timeout is reached, so the forked children cannot hold the exec session open.
+// If the session is still not closed after a grace period, the exec is given up on the client side.
+func (c *SwarmCluster) ExecContainer(id string, cmd []string, timeout time.Duration) (int, []byte, error) {
+	seconds := int((timeout + time.Second - 1) / time.Second)
+	if seconds <= 0 {
+		seconds = 1
+	}
+	script := fmt.Sprintf("set -m 2>/dev/null; \"$@\" & pid=$!; set +m; "+
+		"(sleep %d; kill -9 -$pid || kill -9 $pid) >/dev/null 2>&1 & dog=$!; "+
+		"wait $pid; code=$?; kill $dog >/dev/null 2>&1; echo \"%s$code\"", seconds, kExecExitCodeMarker)
+	wrapped := append([]string{"sh", "-c", script, "sh"}, cmd...)
+	execConfig := adoc.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+		Cmd:          wrapped,
+	}
+	execId, err := c.DockerClient.CreateExec(id, execConfig)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	type execResult struct {
+		output []byte
+		err    error
+	}
+	resultCh := make(chan execResult, 1)
+	go func() {
+		output, err := c.DockerClient.StartExec(execId, false, true)
+		resultCh <- execResult{output, err}
+	}()
+	var output []byte
+	select {
+	case result := <-resultCh:
+		if result.err != nil {
+			return -1, result.output, result.err
 		}
-		return nodes, nil
+		output = result.output
+	case <-time.After(time.Duration(seconds)*time.Second + kExecTimeoutGrace):
+		return -1, nil, fmt.Errorf("Exec %s is not closed after %d seconds", execId, seconds)
+	}
+	pos := bytes.LastIndex(output, []byte(kExecExitCodeMarker))
+	if pos < 0 {
+		return -1, output, fmt.Errorf("Cannot find the exit code of exec %s", execId)
 	}
+	exitCode, err := strconv.Atoi(string(bytes.TrimSpace(output[pos+len(kExecExitCodeMarker):])))
+	if err != nil {
+		return -1, output, err
+	}
+	return exitCode, output[:pos], nil
 }
 
 func NewCluster(addr string, timeout, rwTimeout time.Duration, debug ...bool) (cluster.Cluster, error) {
@@ -42,5 +184,10 @@ func NewCluster(addr string, timeout, rwTimeout time.Duration, debug ...bool) (c
 	}
 	swarm := &SwarmCluster{}
 	swarm.DockerClient = docker
+	swarm.addr = strings.TrimSuffix(strings.Replace(addr, "tcp://", "http://", 1), "/")
+	if !strings.Contains(swarm.addr, "://") {
+		swarm.addr = "http://" + swarm.addr
+	}
+	swarm.httpClient = &http.Client{Timeout: rwTimeout}
 	return swarm, nil
 }
@@ -0,0 +1,72 @@
+package swarm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSwarmNodes(t *testing.T) {
+	status := [][2]string{
+		{"Role", "primary"},
+		{"Strategy", "spread"},
+		{"Filters", "health, port, dependency, affinity, constraint"},
+		{"Nodes", "2"},
+		{" node1", "192.168.77.21:2375"},
+		{"  └ ID", "ABCD:EFGH"},
+		{"  └ Status", "Healthy"},
+		{"  └ Containers", "3 (2 Running, 0 Paused, 1 Stopped)"},
+		{"  └ Reserved CPUs", "1 / 4"},
+		{"  └ Reserved Memory", "512 MiB / 2 GiB"},
+		{"  └ Labels", "executiondriver=native-0.2, storage=ssd, zone=a"},
+		{" node2", "192.168.77.22:2375"},
+		{"  └ Containers", "0"},
+		{"  └ Reserved CPUs", "0 / 2"},
+		{"  └ Reserved Memory", "0 B / 1 GiB"},
+		{"  └ Labels", ""},
+	}
+	nodes := parseSwarmNodes(status)
+	if len(nodes) != 2 {
+		t.Fatalf("Should parse 2 nodes, got %+v", nodes)
+	}
+	node := nodes[0]
+	if node.Name != "node1" || node.Address != "192.168.77.21:2375" || node.Containers != 3 ||
+		node.UsedCPUs != 1 || node.CPUs != 4 || node.UsedMemory != 512*1024*1024 || node.Memory != 2*1024*1024*1024 {
+		t.Errorf("Node1 is parsed wrong, got %+v", node)
+	}
+	if node.Labels["storage"] != "ssd" || node.Labels["zone"] != "a" {
+		t.Errorf("Node1 should have the labels, got %+v", node.Labels)
+	}
+	if node := nodes[1]; node.Name != "node2" || node.CPUs != 2 || node.Labels == nil || len(node.Labels) != 0 {
+		t.Errorf("Node2 is parsed wrong, got %+v", node)
+	}
+}
+
+func TestCopyToContainer(t *testing.T) {
+	var method, path, query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.Query().Get("path")
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		if r.URL.Query().Get("path") == "/missing" {
+			http.Error(w, "no such directory", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewCluster(server.URL, time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("Cannot create the cluster, %s", err)
+	}
+	if err := c.CopyToContainer("abc", "/", []byte("tar")); err != nil {
+		t.Fatalf("Cannot copy to the container, %s", err)
+	}
+	if method != "PUT" || path != "/containers/abc/archive" || query != "/" || body != "tar" {
+		t.Errorf("Should put the archive into the container, got %s %s path=%s body=%s", method, path, query, body)
+	}
+	if err := c.CopyToContainer("abc", "/missing", []byte("tar")); err == nil {
+		t.Errorf("Should return the error of the api")
+	}
+}
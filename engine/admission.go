@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/mijia/sweb/log"
+)
+
+// ResourceShortage is returned when the cluster cannot hold the requested instances,
+// CPUs are the reserved cpu count which swarm takes from the CpuShares
+type ResourceShortage struct {
+	NumInstances   int
+	InstanceCPUs   int
+	InstanceMemory int64
+	RequiredCPUs   int
+	RequiredMemory int64
+	SpareCPUs      int   // the sum of the eligible nodes
+	SpareMemory    int64 // the sum of the eligible nodes
+	Placeable      int   // the number of instances which can be placed on the eligible nodes
+	ShortCPUs      int
+	ShortMemory    int64
+	EligibleNodes  []string
+	BlockedNodes   []string
+}
+
+func (rs *ResourceShortage) Error() string {
+	return fmt.Sprintf("%s, need %d instances of cpu=%d memory=%d, only %d can be placed on %d nodes, short of cpu=%d memory=%d",
+		ErrNotEnoughResources, rs.NumInstances, rs.InstanceCPUs, rs.InstanceMemory,
+		rs.Placeable, len(rs.EligibleNodes), rs.ShortCPUs, rs.ShortMemory)
+}
+
+// isNodeBlocked checks the node against the hard node constraints, other constraints cannot be checked here
+func isNodeBlocked(node cluster.Node, constraints map[string]ConstraintSpec) bool {
+	for _, cstSpec := range constraints {
+		if cstSpec.Type != "node" || cstSpec.Soft {
+			continue
+		}
+		matched := cstSpec.Value == node.Name
+		if !matched {
+			matched, _ = path.Match(cstSpec.Value, node.Name)
+		}
+		if matched != cstSpec.Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResources returns nil if numInstances pods of the spec can be placed on the nodes, every pod
+// should be placed on a single node since all the containers follow the first one. The pod binding
+// fixed host ports takes the whole node, the usedNodes already running the pod group are not eligible.
+func checkResources(nodes []cluster.Node, constraints map[string]ConstraintSpec, spec PodSpec, numInstances int,
+	usedNodes map[string]bool) *ResourceShortage {
+	cpus, memory := podResources(spec)
+	return checkPlacement(nodes, constraints, cpus, memory, spec.HasHostPorts(), numInstances, usedNodes)
+}
+
+// checkSpecResources checks the spec update of numInstances pods. The surge instances are deployed beside the
+// old ones, so up to surge new pods need the whole resources of the new spec, the other instances are replaced
+// in place and only their increased resources need more room.
+func checkSpecResources(nodes []cluster.Node, constraints map[string]ConstraintSpec, oldSpec, newSpec PodSpec,
+	numInstances, surge int, usedNodes map[string]bool) *ResourceShortage {
+	if surge > 0 {
+		if rs := checkResources(nodes, constraints, newSpec, surge, usedNodes); rs != nil {
+			return rs
+		}
+	}
+	oldCPUs, oldMemory := podResources(oldSpec)
+	newCPUs, newMemory := podResources(newSpec)
+	cpus, memory := newCPUs-oldCPUs, newMemory-oldMemory
+	if cpus < 0 {
+		cpus = 0
+	}
+	if memory < 0 {
+		memory = 0
+	}
+	// the instances are on different nodes already if the old pod binds host ports too
+	exclusive := newSpec.HasHostPorts() && !oldSpec.HasHostPorts()
+	return checkPlacement(nodes, constraints, cpus, memory, exclusive, numInstances, nil)
+}
+
+func checkPlacement(nodes []cluster.Node, constraints map[string]ConstraintSpec, cpus int, memory int64, exclusive bool,
+	numInstances int, usedNodes map[string]bool) *ResourceShortage {
+	rs := &ResourceShortage{NumInstances: numInstances, InstanceCPUs: cpus, InstanceMemory: memory}
+	if numInstances <= 0 || (rs.InstanceCPUs == 0 && rs.InstanceMemory == 0 && !exclusive) {
+		return nil
+	}
+	rs.RequiredCPUs = rs.InstanceCPUs * numInstances
+	rs.RequiredMemory = rs.InstanceMemory * int64(numInstances)
+
+	for _, node := range nodes {
+		if isNodeBlocked(node, constraints) || (exclusive && usedNodes[node.Name]) {
+			rs.BlockedNodes = append(rs.BlockedNodes, node.Name)
+			continue
+		}
+		rs.EligibleNodes = append(rs.EligibleNodes, node.Name)
+		spareCPUs, spareMemory := node.SpareCPUs(), node.SpareMemory()
+		if spareCPUs > 0 {
+			rs.SpareCPUs += spareCPUs
+		}
+		if spareMemory > 0 {
+			rs.SpareMemory += spareMemory
+		}
+		fit := numInstances
+		if rs.InstanceCPUs > 0 {
+			if n := spareCPUs / rs.InstanceCPUs; n < fit {
+				fit = n
+			}
+		}
+		if rs.InstanceMemory > 0 {
+			if n := int(spareMemory / rs.InstanceMemory); n < fit {
+				fit = n
+			}
+		}
+		if exclusive && fit > 1 {
+			fit = 1
+		}
+		if fit > 0 {
+			rs.Placeable += fit
+		}
+	}
+	if rs.Placeable >= numInstances {
+		return nil
+	}
+	if rs.RequiredCPUs > rs.SpareCPUs {
+		rs.ShortCPUs = rs.RequiredCPUs - rs.SpareCPUs
+	}
+	if rs.RequiredMemory > rs.SpareMemory {
+		rs.ShortMemory = rs.RequiredMemory - rs.SpareMemory
+	}
+	return rs
+}
+
+// admissionNodes fetches the cluster resources for the admission, it should be called before taking the
+// engine lock. The request is let go with nil nodes if the resources cannot be fetched, the scheduling
+// will fail later anyway.
+func (engine *OrcEngine) admissionNodes() ([]cluster.Node, error) {
+	nodes, err := engine.cluster.GetResources()
+	if err != nil {
+		log.Warnf("Engine cannot get the cluster resources for admission, %s", err)
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// admit checks if the nodes have enough resources for the new instances
+func (engine *OrcEngine) admit(nodes []cluster.Node, spec PodSpec, numInstances int, usedNodes map[string]bool) error {
+	if nodes == nil {
+		return nil
+	}
+	if rs := checkResources(nodes, cstController.GetAllConstraints(), spec, numInstances, usedNodes); rs != nil {
+		return rs
+	}
+	return nil
+}
+
+// admitSpec checks if the nodes have enough resources for the instances updated to the new pod spec
+func (engine *OrcEngine) admitSpec(nodes []cluster.Node, oldSpec, newSpec PodSpec, numInstances, surge int,
+	usedNodes map[string]bool) error {
+	if nodes == nil {
+		return nil
+	}
+	if rs := checkSpecResources(nodes, cstController.GetAllConstraints(), oldSpec, newSpec, numInstances, surge, usedNodes); rs != nil {
+		return rs
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	AffinityScopePodGroup  = "podgroup"
+	AffinityScopeNamespace = "namespace"
+)
+
+var (
+	affinityLabelPattern = regexp.MustCompile("^[A-Za-z0-9_.\\-]+$")
+	affinityValuePattern = regexp.MustCompile("^[A-Za-z0-9_.\\-/*?\\[\\]]+$")
+)
+
+// PodAffinity places the pod together with or apart from the pods of a pod group or a namespace
+type PodAffinity struct {
+	Scope    string // podgroup or namespace
+	Value    string // the pod group name or the namespace, glob patterns are allowed
+	Anti     bool   // separation instead of co-location
+	Required bool   // only preferred if false, the rule is ignored when no node matches
+}
+
+func (a PodAffinity) VerifyParams() bool {
+	return (a.Scope == AffinityScopePodGroup || a.Scope == AffinityScopeNamespace) &&
+		affinityValuePattern.MatchString(a.Value)
+}
+
+func (a PodAffinity) Filter() string {
+	label := kLainLabelPrefix + ".pg_name"
+	if a.Scope == AffinityScopeNamespace {
+		label = kLainLabelPrefix + ".pg_namespace"
+	}
+	return fmt.Sprintf("affinity:%s%s%s", label, filterOperator(!a.Anti, !a.Required), a.Value)
+}
+
+// NodeRequirement asks for the nodes with the label, the label "node" is the node name
+type NodeRequirement struct {
+	Label    string
+	Value    string
+	NotEqual bool
+	Required bool
+}
+
+func (r NodeRequirement) VerifyParams() bool {
+	return affinityLabelPattern.MatchString(r.Label) && affinityValuePattern.MatchString(r.Value)
+}
+
+func (r NodeRequirement) Filter() string {
+	return fmt.Sprintf("constraint:%s%s%s", r.Label, filterOperator(!r.NotEqual, !r.Required), r.Value)
+}
+
+// AffinitySpec is the typed placement rules of the pod, they are kept in the spec while the Filters
+// are only used for the next deployment.
+type AffinitySpec struct {
+	Pods  []PodAffinity
+	Nodes []NodeRequirement
+}
+
+func (s AffinitySpec) Clone() AffinitySpec {
+	n := AffinitySpec{}
+	if s.Pods != nil {
+		n.Pods = make([]PodAffinity, len(s.Pods))
+		copy(n.Pods, s.Pods)
+	}
+	if s.Nodes != nil {
+		n.Nodes = make([]NodeRequirement, len(s.Nodes))
+		copy(n.Nodes, s.Nodes)
+	}
+	return n
+}
+
+func (s AffinitySpec) VerifyParams() bool {
+	for _, a := range s.Pods {
+		if !a.VerifyParams() {
+			return false
+		}
+	}
+	for _, r := range s.Nodes {
+		if !r.VerifyParams() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s AffinitySpec) Equals(o AffinitySpec) bool {
+	if len(s.Pods) != len(o.Pods) || len(s.Nodes) != len(o.Nodes) {
+		return false
+	}
+	for i := range s.Pods {
+		if s.Pods[i] != o.Pods[i] {
+			return false
+		}
+	}
+	for i := range s.Nodes {
+		if s.Nodes[i] != o.Nodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Filters translates the rules into the swarm filters
+func (s AffinitySpec) Filters() []string {
+	filters := make([]string, 0, len(s.Pods)+len(s.Nodes))
+	for _, a := range s.Pods {
+		filters = append(filters, a.Filter())
+	}
+	for _, r := range s.Nodes {
+		filters = append(filters, r.Filter())
+	}
+	return filters
+}
+
+func filterOperator(equal bool, soft bool) string {
+	operator := "=="
+	if !equal {
+		operator = "!="
+	}
+	if soft {
+		operator += "~"
+	}
+	return operator
+}
+
+// nodeFilter pins the pod to the node, or keeps it away from the node
+func nodeFilter(nodeName string, equal bool) string {
+	return NodeRequirement{Label: "node", Value: nodeName, NotEqual: !equal, Required: true}.Filter()
+}
+
+func isNodeFilter(filter string) bool {
+	return strings.HasPrefix(filter, "constraint:node==")
+}
@@ -0,0 +1,389 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/adoc"
+	"github.com/mijia/sweb/log"
+)
+
+const kLainConfigRoot = "/data/lain/configs"
+
+var cfgController *configController
+
+// the config names and the file names are used in the paths and the helper scripts
+var configNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// ConfigSpec is a set of files, the key of Data is the file name and the value is the content
+type ConfigSpec struct {
+	Namespace string
+	Name      string
+	Data      map[string]string
+	Version   int
+	UpdatedAt time.Time
+}
+
+func (s ConfigSpec) VerifyParams() bool {
+	if s.Namespace == "" || !configNamePattern.MatchString(s.Name) || len(s.Data) == 0 {
+		return false
+	}
+	for file := range s.Data {
+		if !configNamePattern.MatchString(file) || file == "." || file == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ConfigMountSpec mounts the files of the config in the same namespace into the directory Path of the container.
+// Version is filled by the engine with the config version the pod is deployed with, a new version of the config
+// changes the spec and restarts the pod groups by the rolling update.
+type ConfigMountSpec struct {
+	Config  string
+	Path    string
+	Version int
+}
+
+func (s ConfigMountSpec) VerifyParams() bool {
+	return s.Config != "" && strings.HasPrefix(s.Path, "/") && s.Version >= 0
+}
+
+// configHostDir is where the version of the config is rendered on the node
+func configHostDir(namespace, name string, version int) string {
+	return fmt.Sprintf("%s/%s/%s/%d", kLainConfigRoot, namespace, name, version)
+}
+
+type configController struct {
+	sync.RWMutex
+
+	configs  map[string]ConfigSpec   // namespace/name to the config
+	versions map[string][]ConfigSpec // namespace/name to the kept versions of the config, the oldest first
+}
+
+func NewConfigController() *configController {
+	return &configController{
+		configs:  make(map[string]ConfigSpec),
+		versions: make(map[string][]ConfigSpec),
+	}
+}
+
+func configVersionsKey(namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainConfigVersionKey, namespace, name)
+}
+
+func (cc *configController) LoadConfigs(store storage.Store) error {
+	configs := make(map[string]ConfigSpec)
+	configsKey := fmt.Sprintf("%s/%s", kLainDeploydRootKey, kLainConfigKey)
+	if namespaces, err := store.KeysByPrefix(configsKey); err != nil {
+		if err != storage.ErrNoSuchKey {
+			return err
+		}
+	} else {
+		for _, namespace := range namespaces {
+			keys, err := store.KeysByPrefix(namespace)
+			if err != nil && err != storage.ErrNoSuchKey {
+				return err
+			}
+			for _, key := range keys {
+				var config ConfigSpec
+				if err := store.Get(key, &config); err != nil {
+					log.Errorf("Failed to load config %s from storage, %s", key, err)
+					return err
+				}
+				configs[config.Namespace+"/"+config.Name] = config
+				log.Infof("Loaded config %s/%s from storage, version=%d", config.Namespace, config.Name, config.Version)
+			}
+		}
+	}
+	versions := make(map[string][]ConfigSpec)
+	for id, config := range configs {
+		var kept []ConfigSpec
+		key := configVersionsKey(config.Namespace, config.Name)
+		if err := store.Get(key, &kept); err != nil && err != storage.ErrNoSuchKey {
+			log.Errorf("Failed to load config versions %s from storage, %s", key, err)
+			return err
+		}
+		if len(kept) == 0 || kept[len(kept)-1].Version != config.Version {
+			// the configs saved before the history was kept
+			kept = append(kept, config)
+		}
+		versions[id] = kept
+	}
+	cc.Lock()
+	cc.configs = configs
+	cc.versions = versions
+	cc.Unlock()
+	return nil
+}
+
+func (cc *configController) GetConfig(namespace, name string) (ConfigSpec, bool) {
+	cc.RLock()
+	defer cc.RUnlock()
+	config, ok := cc.configs[namespace+"/"+name]
+	return config, ok
+}
+
+// GetConfigVersion returns the content of the config with the version, the old versions are kept in the history
+func (cc *configController) GetConfigVersion(namespace, name string, version int) (ConfigSpec, bool) {
+	cc.RLock()
+	defer cc.RUnlock()
+	for _, config := range cc.versions[namespace+"/"+name] {
+		if config.Version == version {
+			return config, true
+		}
+	}
+	return ConfigSpec{}, false
+}
+
+// GetConfigs returns the configs in the namespace, or all the configs if namespace is empty
+func (cc *configController) GetConfigs(namespace string) []ConfigSpec {
+	cc.RLock()
+	defer cc.RUnlock()
+	configs := make([]ConfigSpec, 0, len(cc.configs))
+	for _, config := range cc.configs {
+		if namespace == "" || config.Namespace == namespace {
+			configs = append(configs, config)
+		}
+	}
+	sort.Sort(configsByName(configs))
+	return configs
+}
+
+// SetConfig saves the config as a new version, returns false if nothing is changed. The old versions are kept
+// in the history for the rollbacks, the latest RevisionHistoryLimit versions and the versions in inUse are kept.
+func (cc *configController) SetConfig(config ConfigSpec, inUse map[int]bool, store storage.Store) (bool, error) {
+	cc.Lock()
+	defer cc.Unlock()
+	old, ok := cc.configs[config.Namespace+"/"+config.Name]
+	if ok && len(old.Data) == len(config.Data) {
+		changed := false
+		for file, content := range config.Data {
+			if oldContent, ok := old.Data[file]; !ok || oldContent != content {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return false, nil
+		}
+	}
+	config.Version = old.Version + 1
+	config.UpdatedAt = time.Now()
+	id := config.Namespace + "/" + config.Name
+	// the version is saved into the history first, so a mounted version always has its content
+	versions := keptConfigVersions(append(cc.versions[id], config), inUse)
+	versionsKey := configVersionsKey(config.Namespace, config.Name)
+	if err := store.Set(versionsKey, versions, true); err != nil {
+		log.Warnf("Failed to set config versions key %s, %s", versionsKey, err)
+		return false, err
+	}
+	cc.versions[id] = versions
+	key := fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainConfigKey, config.Namespace, config.Name)
+	if err := store.Set(key, config); err != nil {
+		log.Warnf("Failed to set config key %s, %s", key, err)
+		return false, err
+	}
+	cc.configs[id] = config
+	return true, nil
+}
+
+// keptConfigVersions drops the old versions which are beyond RevisionHistoryLimit and not in use
+func keptConfigVersions(versions []ConfigSpec, inUse map[int]bool) []ConfigSpec {
+	if RevisionHistoryLimit <= 0 || len(versions) <= RevisionHistoryLimit {
+		return versions
+	}
+	kept := make([]ConfigSpec, 0, RevisionHistoryLimit)
+	dropped := len(versions) - RevisionHistoryLimit
+	for i, config := range versions {
+		if i >= dropped || inUse[config.Version] {
+			kept = append(kept, config)
+		}
+	}
+	return kept
+}
+
+func (cc *configController) RemoveConfig(namespace, name string, store storage.Store) error {
+	cc.Lock()
+	defer cc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainConfigKey, namespace, name)
+	if err := store.Remove(key); err != nil {
+		log.Warnf("Failed to remove config key %s, %s", key, err)
+		return err
+	}
+	store.TryRemoveDir(fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainConfigKey, namespace))
+	versionsKey := configVersionsKey(namespace, name)
+	if err := store.Remove(versionsKey); err != nil && err != storage.ErrNoSuchKey {
+		log.Warnf("Failed to remove config versions key %s, %s", versionsKey, err)
+	}
+	store.TryRemoveDir(fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainConfigVersionKey, namespace))
+	delete(cc.configs, namespace+"/"+name)
+	delete(cc.versions, namespace+"/"+name)
+	return nil
+}
+
+// pinConfigVersions returns the pod spec with the current versions of the configs in the namespace
+func pinConfigVersions(spec PodSpec, namespace string) (PodSpec, error) {
+	newSpec := spec.Clone()
+	for _, containers := range [][]ContainerSpec{newSpec.InitContainers, newSpec.Containers} {
+		for i := range containers {
+			for j := range containers[i].Configs {
+				mount := &containers[i].Configs[j]
+				config, ok := cfgController.GetConfig(namespace, mount.Config)
+				if !ok {
+					return spec, ErrConfigNotExists
+				}
+				mount.Version = config.Version
+			}
+		}
+	}
+	return newSpec, nil
+}
+
+// configVersionsExist checks whether the pinned versions of the configs are still in the history
+func configVersionsExist(spec PodSpec, namespace string) bool {
+	for _, containers := range [][]ContainerSpec{spec.InitContainers, spec.Containers} {
+		for _, cSpec := range containers {
+			for _, mount := range cSpec.Configs {
+				if _, ok := cfgController.GetConfigVersion(namespace, mount.Config, mount.Version); !ok {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// addConfigVersions adds the versions of the config mounted by the pod
+func addConfigVersions(versions map[int]bool, spec PodSpec, namespace, name string) {
+	if spec.Namespace != namespace {
+		return
+	}
+	for _, containers := range [][]ContainerSpec{spec.InitContainers, spec.Containers} {
+		for _, cSpec := range containers {
+			for _, mount := range cSpec.Configs {
+				if mount.Config == name {
+					versions[mount.Version] = true
+				}
+			}
+		}
+	}
+}
+
+// podSpecUsesConfig checks whether the containers of the pod mount the config
+func podSpecUsesConfig(spec PodSpec, namespace, name string) bool {
+	if spec.Namespace != namespace {
+		return false
+	}
+	for _, containers := range [][]ContainerSpec{spec.InitContainers, spec.Containers} {
+		for _, cSpec := range containers {
+			for _, mount := range cSpec.Configs {
+				if mount.Config == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// configBinds mounts the rendered configs read only
+func configBinds(namespace string, spec ContainerSpec) []string {
+	binds := make([]string, 0, len(spec.Configs))
+	for _, mount := range spec.Configs {
+		binds = append(binds, fmt.Sprintf("%s:%s:ro", configHostDir(namespace, mount.Config, mount.Version), mount.Path))
+	}
+	return binds
+}
+
+// renderConfigs writes the mounted configs onto the node by a helper container before the containers are created.
+// The content is copied into the helper as a tar archive, the rendered versions are left as they are, the content
+// of a version never changes. Returns the node the configs are rendered on.
+func (pc *podController) renderConfigs(c cluster.Cluster, filters []string) (string, error) {
+	var scripts []string
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	rendered := make(map[string]bool)
+	for _, containers := range [][]ContainerSpec{pc.spec.InitContainers, pc.spec.Containers} {
+		for _, cSpec := range containers {
+			for _, mount := range cSpec.Configs {
+				dir := configHostDir(pc.spec.Namespace, mount.Config, mount.Version)
+				if rendered[dir] {
+					continue
+				}
+				rendered[dir] = true
+				// the spec may be rolled back to an old version, its own content is rendered from the history
+				config, ok := cfgController.GetConfigVersion(pc.spec.Namespace, mount.Config, mount.Version)
+				if !ok {
+					return "", fmt.Errorf("Cannot render config %s version %d, %s", mount.Config, mount.Version, ErrConfigVersionNotExists)
+				}
+				source := fmt.Sprintf("deployd-configs/%s/%d", mount.Config, mount.Version)
+				for file, content := range config.Data {
+					header := &tar.Header{
+						Name:    fmt.Sprintf("%s/%s", source, file),
+						Mode:    0644,
+						Size:    int64(len(content)),
+						ModTime: now,
+					}
+					if err := tw.WriteHeader(header); err != nil {
+						return "", err
+					}
+					if _, err := tw.Write([]byte(content)); err != nil {
+						return "", err
+					}
+				}
+				target := fmt.Sprintf("/configs/%s/%d", mount.Config, mount.Version)
+				tmpName := fmt.Sprintf("%d.%d.%d", mount.Version, pc.pod.InstanceNo, now.UnixNano())
+				tmp := fmt.Sprintf("/configs/%s/%s", mount.Config, tmpName)
+				script := []string{
+					fmt.Sprintf("mkdir -p %s", tmp),
+					fmt.Sprintf("cp -R /%s/. %s", source, tmp),
+					// another instance may have rendered it at the same time, the tmp dir is moved into it then
+					fmt.Sprintf("(mv %s %s; rm -rf %s %s/%s)", tmp, target, tmp, target, tmpName),
+				}
+				scripts = append(scripts, fmt.Sprintf("[ -d %s ] || (%s)", target, strings.Join(script, " && ")))
+			}
+		}
+	}
+	if len(scripts) == 0 {
+		return "", nil
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	cc := adoc.ContainerConfig{
+		Cmd: []string{"sh", "-c", strings.Join(scripts, " && ")},
+		Env: filters,
+	}
+	hc := adoc.HostConfig{
+		Binds: []string{fmt.Sprintf("%s/%s:/configs", kLainConfigRoot, pc.spec.Namespace)},
+	}
+	name := fmt.Sprintf("deployd.config-helper.%s.%d.%d", pc.spec.Name, pc.pod.InstanceNo, now.Unix())
+	log.Infof("%s render configs, filter is %v", pc, filters)
+	info, err := runHelperContainer(c, cc, hc, name, buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("Cannot render configs, %s", err)
+	}
+	return info.Node.Name, nil
+}
+
+type configsByName []ConfigSpec
+
+func (s configsByName) Len() int      { return len(s) }
+func (s configsByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s configsByName) Less(i, j int) bool {
+	if s[i].Namespace != s[j].Namespace {
+		return s[i].Namespace < s[j].Namespace
+	}
+	return s[i].Name < s[j].Name
+}
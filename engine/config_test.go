@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/mijia/adoc"
+)
+
+// withConfigController sets a new config controller and returns the func to restore the old one
+func withConfigController() (*configController, func()) {
+	old, oldLimit := cfgController, RevisionHistoryLimit
+	cfgController = NewConfigController()
+	return cfgController, func() {
+		cfgController, RevisionHistoryLimit = old, oldLimit
+	}
+}
+
+func configTestSpec(content string) ConfigSpec {
+	return ConfigSpec{Namespace: "hello", Name: "nginx", Data: map[string]string{"default.conf": content}}
+}
+
+func TestConfigVersions(t *testing.T) {
+	cc, restore := withConfigController()
+	defer restore()
+	store := newMemStore()
+	for _, content := range []string{"v1", "v2"} {
+		if changed, err := cc.SetConfig(configTestSpec(content), nil, store); err != nil || !changed {
+			t.Fatalf("Should set the config %s, got changed=%v, %v", content, changed, err)
+		}
+	}
+	if changed, _ := cc.SetConfig(configTestSpec("v2"), nil, store); changed {
+		t.Errorf("Same content should not be a new version")
+	}
+	if config, _ := cc.GetConfig("hello", "nginx"); config.Version != 2 || config.Data["default.conf"] != "v2" {
+		t.Errorf("Current config should be version 2, got %+v", config)
+	}
+	// the old version is rendered with its own content
+	if config, ok := cc.GetConfigVersion("hello", "nginx", 1); !ok || config.Data["default.conf"] != "v1" {
+		t.Errorf("Version 1 should keep its content, got %+v", config)
+	}
+	if _, ok := cc.GetConfigVersion("hello", "nginx", 3); ok {
+		t.Errorf("Version 3 should not exist")
+	}
+	if keys, _ := store.KeysByPrefix(configVersionsKey("hello", "nginx")); len(keys) != 1 {
+		t.Errorf("Versions should be saved into the store, got %v", keys)
+	}
+
+	if err := cc.RemoveConfig("hello", "nginx", store); err != nil {
+		t.Fatalf("Cannot remove the config, %s", err)
+	}
+	if _, ok := cc.GetConfigVersion("hello", "nginx", 1); ok {
+		t.Errorf("Versions should be removed with the config")
+	}
+	if keys, _ := store.KeysByPrefix(configVersionsKey("hello", "nginx")); len(keys) != 0 {
+		t.Errorf("Versions should be removed from the store, got %v", keys)
+	}
+}
+
+func TestConfigVersionsLimit(t *testing.T) {
+	cc, restore := withConfigController()
+	defer restore()
+	store := newMemStore()
+	RevisionHistoryLimit = 2
+	cc.SetConfig(configTestSpec("v1"), nil, store)
+	cc.SetConfig(configTestSpec("v2"), nil, store)
+	// version 1 is still mounted by a pod
+	cc.SetConfig(configTestSpec("v3"), map[int]bool{1: true}, store)
+	cc.SetConfig(configTestSpec("v4"), map[int]bool{1: true}, store)
+	for version, kept := range map[int]bool{1: true, 2: false, 3: true, 4: true} {
+		if _, ok := cc.GetConfigVersion("hello", "nginx", version); ok != kept {
+			t.Errorf("Version %d should be kept=%v, got %v", version, kept, ok)
+		}
+	}
+
+	spec := PodSpec{Containers: []ContainerSpec{{Configs: []ConfigMountSpec{{Config: "nginx", Path: "/etc/nginx", Version: 2}}}}}
+	spec.Namespace = "hello"
+	if configVersionsExist(spec, "hello") {
+		t.Errorf("Dropped version should not exist")
+	}
+	versions := make(map[int]bool)
+	addConfigVersions(versions, spec, "hello", "nginx")
+	addConfigVersions(versions, spec, "hello", "redis")
+	if len(versions) != 1 || !versions[2] {
+		t.Errorf("Should collect the mounted version of nginx, got %v", versions)
+	}
+	if pinned, err := pinConfigVersions(spec, "hello"); err != nil || !configVersionsExist(pinned, "hello") {
+		t.Errorf("Pinned spec should mount the current version, got %+v, %v", pinned, err)
+	}
+}
+
+// helperCluster records the helper container, the other methods of cluster.Cluster are not expected to be called
+type helperCluster struct {
+	cluster.Cluster
+	cc      adoc.ContainerConfig
+	archive []byte
+	started bool
+}
+
+func (c *helperCluster) CreateContainer(cc adoc.ContainerConfig, hc adoc.HostConfig, nc adoc.NetworkingConfig, name ...string) (string, error) {
+	c.cc = cc
+	return "helper", nil
+}
+
+func (c *helperCluster) CopyToContainer(id string, path string, archive []byte) error {
+	if c.started {
+		return fmt.Errorf("Container %s is started", id)
+	}
+	c.archive = archive
+	return nil
+}
+
+func (c *helperCluster) StartContainer(id string) error {
+	c.started = true
+	return nil
+}
+
+func (c *helperCluster) InspectContainer(id string) (adoc.ContainerDetail, error) {
+	var info adoc.ContainerDetail
+	info.Node.Name = "node1"
+	return info, nil
+}
+
+func (c *helperCluster) RemoveContainer(id string, force bool, volumes bool) error {
+	return nil
+}
+
+func TestRenderConfigs(t *testing.T) {
+	cc, restore := withConfigController()
+	defer restore()
+	store := newMemStore()
+	cc.SetConfig(configTestSpec("v1"), nil, store)
+	cc.SetConfig(configTestSpec("v2"), nil, store)
+
+	pc := &podController{}
+	pc.spec.Namespace = "hello"
+	pc.spec.Name = "hello.web.web"
+	pc.spec.Containers = []ContainerSpec{{Configs: []ConfigMountSpec{{Config: "nginx", Path: "/etc/nginx", Version: 1}}}}
+	c := &helperCluster{}
+	node, err := pc.renderConfigs(c, []string{nodeFilter("node1", true)})
+	if err != nil || node != "node1" {
+		t.Fatalf("Should render the configs on node1, got %q, %v", node, err)
+	}
+	for _, env := range c.cc.Env {
+		if strings.Contains(env, "v1") || strings.HasPrefix(env, "DEPLOYD_CONFIG") {
+			t.Errorf("Content should not be passed by the env, got %q", env)
+		}
+	}
+	tr := tar.NewReader(bytes.NewReader(c.archive))
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("Cannot read the archive, %s", err)
+	}
+	if header.Name != "deployd-configs/nginx/1/default.conf" {
+		t.Errorf("Archive should have the file of version 1, got %s", header.Name)
+	}
+	// the pinned old version is rendered with its own content, not the current one
+	if content, _ := ioutil.ReadAll(tr); string(content) != "v1" {
+		t.Errorf("Version 1 should be rendered with its content, got %q", content)
+	}
+	if script := strings.Join(c.cc.Cmd, " "); !strings.Contains(script, "/configs/nginx/1") {
+		t.Errorf("Helper should render into the directory of version 1, got %s", script)
+	}
+
+	pc.spec.Containers[0].Configs[0].Version = 5
+	if _, err := pc.renderConfigs(&helperCluster{}, nil); err == nil {
+		t.Errorf("Should not render the version which does not exist")
+	}
+}
@@ -43,7 +43,7 @@ func (cc *constraintController) LoadConstraints(store storage.Store) error {
 				return err
 			}
 			constraints[cstSpec.Type] = cstSpec
-			log.Infof("Loaded constraint %s from storage, %s", cstSpec.Type, cstSpec)
+			log.Infof("Loaded constraint %s from storage, %+v", cstSpec.Type, cstSpec)
 		}
 	}
 	cc.constraints = constraints
@@ -51,14 +51,7 @@ func (cc *constraintController) LoadConstraints(store storage.Store) error {
 }
 
 func (cc *constraintController) LoadFilterFromConstrain(cstSpec ConstraintSpec) string {
-	operator := "=="
-	if !cstSpec.Equal {
-		operator = "!="
-	}
-	if cstSpec.Soft {
-		operator += "~"
-	}
-	return fmt.Sprintf("constraint:%s%s%s", cstSpec.Type, operator, cstSpec.Value)
+	return fmt.Sprintf("constraint:%s%s%s", cstSpec.Type, filterOperator(cstSpec.Equal, cstSpec.Soft), cstSpec.Value)
 }
 
 func (cc *constraintController) GetAllConstraints() map[string]ConstraintSpec {
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/laincloud/deployd/utils/cron"
+	"github.com/mijia/sweb/log"
+)
+
+// CronCheckInterval is the seconds between the checks of the cron jobs
+var CronCheckInterval = 30
+
+// pgOperBeginCron marks the cron pod group running, it has no instances itself
+type pgOperBeginCron struct{}
+
+func (op pgOperBeginCron) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	if pgCtrl.group.Cron == nil {
+		pgCtrl.group.Cron = &CronStatus{}
+	}
+	pgCtrl.group.Pods = nil
+	pgCtrl.group.State = RunStateSuccess
+	pgCtrl.group.LastError = ""
+	pgCtrl.group.UpdatedAt = time.Now()
+	return false
+}
+
+func (pgCtrl *podGroupController) IsCron() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	return pgCtrl.spec.IsCron()
+}
+
+func (pgCtrl *podGroupController) deployCron(spec PodGroupSpec) {
+	pgCtrl.opsChan <- pgOperLogOperation{"Start to deploy cron job"}
+	pgCtrl.opsChan <- pgOperSaveRevision{spec.Version, spec.Pod}
+	pgCtrl.opsChan <- pgOperBeginCron{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"deploy cron job finished"}
+}
+
+// setCronStatus is called by the engine only, the status is saved at once so the next leader can go on with it
+func (pgCtrl *podGroupController) setCronStatus(status CronStatus) {
+	pgCtrl.Lock()
+	pgCtrl.group.Cron = &status
+	pgCtrl.group.UpdatedAt = time.Now()
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+}
+
+// cronRunName is decided by the scheduled time, so the run started by the former leader is taken over
+// instead of being started again.
+func cronRunName(name string, scheduledAt time.Time) string {
+	return fmt.Sprintf("%s-%d", name, scheduledAt.Unix())
+}
+
+// scheduleCronJobs collects the finished runs of the cron jobs and starts the runs which are due
+func (engine *OrcEngine) scheduleCronJobs() {
+	var pgCtrls []*podGroupController
+	engine.RLock()
+	for _, pgCtrl := range engine.pgCtrls {
+		if pgCtrl.IsCron() {
+			pgCtrls = append(pgCtrls, pgCtrl)
+		}
+	}
+	engine.RUnlock()
+	now := time.Now()
+	for _, pgCtrl := range pgCtrls {
+		engine.scheduleCronJob(pgCtrl, now)
+	}
+}
+
+func (engine *OrcEngine) scheduleCronJob(pgCtrl *podGroupController, now time.Time) {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	var status CronStatus
+	if pgCtrl.group.Cron != nil {
+		status = pgCtrl.group.Cron.Clone()
+	}
+	pgCtrl.RUnlock()
+
+	schedule, err := cron.Parse(spec.Cron.Schedule)
+	if err != nil {
+		log.Warnf("<OrcEngine> Bad schedule of cron job %s, %s", spec.Name, err)
+		return
+	}
+	changed := engine.collectCronRuns(&status, now)
+	since := status.LastScheduleTime
+	if since.IsZero() {
+		since = spec.CreatedAt
+	}
+	if due := schedule.Next(since); !due.IsZero() && !due.After(now) && !spec.Stopped {
+		// the missed schedules during the failover are merged into one run
+		engine.startCronRun(spec, &status, due, now)
+		status.LastScheduleTime = now
+		changed = true
+	}
+	if next := schedule.Next(now); !next.Equal(status.NextScheduleTime) {
+		status.NextScheduleTime = next
+		changed = true
+	}
+	if n := len(status.Runs) - spec.Cron.GetHistoryLimit(); n > 0 {
+		for _, run := range status.Runs[:n] {
+			if _, err := engine.RemovePodGroup(run.Name); err != nil && err != ErrPodGroupNotExists {
+				log.Warnf("<OrcEngine> Cannot remove the run %s of cron job %s, %s", run.Name, spec.Name, err)
+			}
+		}
+		status.Runs = append([]CronRun{}, status.Runs[n:]...)
+		changed = true
+	}
+	if changed {
+		pgCtrl.setCronStatus(status)
+	}
+}
+
+// collectCronRuns moves the finished active runs into the history
+func (engine *OrcEngine) collectCronRuns(status *CronStatus, now time.Time) bool {
+	changed := false
+	var active []CronRun
+	for _, run := range status.Active {
+		pg, ok := engine.InspectPodGroup(run.Name)
+		switch {
+		case !ok:
+			run.State = CronRunStateRemoved
+			run.Reason = "Run pod group not existed"
+			run.FinishedAt = now
+		case pg.Job == nil || !pg.Job.IsFinished():
+			active = append(active, run)
+			continue
+		default:
+			run.State = pg.Job.State
+			run.Reason = pg.Job.Reason
+			run.FinishedAt = pg.Job.FinishedAt
+		}
+		status.Runs = append(status.Runs, run)
+		changed = true
+	}
+	status.Active = active
+	return changed
+}
+
+func (engine *OrcEngine) startCronRun(spec PodGroupSpec, status *CronStatus, scheduledAt time.Time, now time.Time) {
+	run := CronRun{
+		Name:        cronRunName(spec.Name, scheduledAt),
+		Version:     spec.Version,
+		State:       JobStateRunning,
+		ScheduledAt: scheduledAt,
+	}
+	if len(status.Active) > 0 {
+		switch spec.Cron.ConcurrencyPolicy {
+		case CronConcurrencyForbid:
+			log.Infof("<OrcEngine> Cron job %s has active runs, skip %s", spec.Name, run.Name)
+			run.State = CronRunStateSkipped
+			run.Reason = fmt.Sprintf("%d runs are still active", len(status.Active))
+			run.FinishedAt = now
+			status.Runs = append(status.Runs, run)
+			return
+		case CronConcurrencyReplace:
+			for _, active := range status.Active {
+				log.Infof("<OrcEngine> Cron job %s replaces the run %s with %s", spec.Name, active.Name, run.Name)
+				if _, err := engine.RemovePodGroup(active.Name); err != nil && err != ErrPodGroupNotExists {
+					log.Warnf("<OrcEngine> Cannot remove the run %s of cron job %s, %s", active.Name, spec.Name, err)
+				}
+				active.State = CronRunStateReplaced
+				active.Reason = fmt.Sprintf("Replaced by %s", run.Name)
+				active.FinishedAt = now
+				status.Runs = append(status.Runs, active)
+			}
+			status.Active = nil
+		}
+	}
+	log.Infof("<OrcEngine> Cron job %s starts the run %s", spec.Name, run.Name)
+	if _, err := engine.NewPodGroup(spec.CronRunSpec(run.Name)); err != nil && err != ErrPodGroupExists {
+		log.Warnf("<OrcEngine> Cannot start the run %s of cron job %s, %s", run.Name, spec.Name, err)
+		run.State = JobStateFailed
+		run.Reason = err.Error()
+		run.FinishedAt = now
+		status.Runs = append(status.Runs, run)
+		return
+	}
+	status.Active = append(status.Active, run)
+}
+
+// removeCronRuns removes the runs with the cron job, the engine lock should be held by the caller
+func (engine *OrcEngine) removeCronRuns(pgCtrl *podGroupController) {
+	pgCtrl.RLock()
+	var runs []CronRun
+	if cronStatus := pgCtrl.group.Cron; cronStatus != nil {
+		runs = append(runs, cronStatus.Active...)
+		runs = append(runs, cronStatus.Runs...)
+	}
+	pgCtrl.RUnlock()
+	for _, run := range runs {
+		if runCtrl, ok := engine.pgCtrls[run.Name]; ok {
+			engine.trackPodGroupOperation("remove", run.Name, runCtrl, orcOperRemove{runCtrl})
+			delete(engine.pgCtrls, run.Name)
+			engine.rmPgCtrls[run.Name] = runCtrl
+			go engine.checkPodGroupRemoveResult(run.Name, runCtrl)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/sweb/log"
+)
+
+// eligibleDaemonNodes returns the sorted nodes which the daemon should run on, the nodes blocked by the
+// required constraints on the node names or the node labels are excluded, including the global constraints,
+// the filters and the node affinities of the pod
+func eligibleDaemonNodes(nodes []cluster.Node, podSpec PodSpec) []string {
+	filters := make([]string, 0, len(podSpec.Filters)+len(podSpec.Affinity.Nodes))
+	filters = append(filters, podSpec.Filters...)
+	for _, r := range podSpec.Affinity.Nodes {
+		filters = append(filters, r.Filter())
+	}
+	for _, cstSpec := range cstController.GetAllConstraints() {
+		filters = append(filters, cstController.LoadFilterFromConstrain(cstSpec))
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		eligible := true
+		for _, filter := range filters {
+			if cst, ok := parseConstraintFilter(filter); ok && !cst.Soft && !cst.Match(node) {
+				eligible = false
+				break
+			}
+		}
+		if eligible {
+			names = append(names, node.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pgOperSetDaemonNode gives the slot of the daemon to another node, or leaves it vacant if the node is empty.
+// The instance in the slot should have been removed.
+type pgOperSetDaemonNode struct {
+	instanceNo int
+	node       string
+}
+
+func (op pgOperSetDaemonNode) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.RLock()
+	podSpec := pgCtrl.spec.InstancePodSpec(op.instanceNo).Clone()
+	pgCtrl.RUnlock()
+	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	var pod Pod
+	pod.InstanceNo = op.instanceNo
+	pod.State = RunStatePending
+	if op.node == "" {
+		pod.State = RunStateRemoved
+	}
+	podCtrl.pod = pod
+	podCtrl.node = op.node
+	podCtrl.vacant = op.node == ""
+	podCtrl.spec = podSpec
+	podCtrl.spec.PrevState = NewPodPrevState(1)
+	return false
+}
+
+func (pgCtrl *podGroupController) IsDaemon() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	return pgCtrl.spec.IsDaemon()
+}
+
+// daemonSlots returns the nodes of the daemon slots after the nodes changed, and the instance numbers of the slots
+// whose nodes left. The instance of a node keeps its number as long as the node stays. The slots of the left
+// nodes are left vacant, the joined nodes take the vacant slots first and then get the new slots.
+// The vacant slots at the end are dropped.
+func daemonSlots(curNodes []string, nodes []string) ([]string, []int) {
+	eligible := make(map[string]bool)
+	for _, node := range nodes {
+		eligible[node] = true
+	}
+	daemonNodes := make([]string, len(curNodes))
+	copy(daemonNodes, curNodes)
+
+	var left []int
+	running := make(map[string]bool)
+	for i, node := range daemonNodes {
+		if node == "" {
+			continue
+		}
+		if eligible[node] {
+			running[node] = true
+		} else {
+			daemonNodes[i] = ""
+			left = append(left, i+1)
+		}
+	}
+	vacant := 0
+	for _, node := range nodes {
+		if running[node] {
+			continue
+		}
+		for vacant < len(daemonNodes) && daemonNodes[vacant] != "" {
+			vacant += 1
+		}
+		if vacant < len(daemonNodes) {
+			daemonNodes[vacant] = node
+		} else {
+			daemonNodes = append(daemonNodes, node)
+		}
+	}
+	for len(daemonNodes) > 0 && daemonNodes[len(daemonNodes)-1] == "" {
+		daemonNodes = daemonNodes[:len(daemonNodes)-1]
+	}
+	return daemonNodes, left
+}
+
+// ScheduleDaemon makes the daemon instances follow the nodes, see daemonSlots for how the instances are numbered
+func (pgCtrl *podGroupController) ScheduleDaemon(nodes []string) {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Daemon == nil {
+		return
+	}
+	curNodes := spec.Daemon.Nodes
+	daemonNodes, left := daemonSlots(curNodes, nodes)
+	if spec.Daemon.Equals(DaemonSpec{Nodes: daemonNodes}) {
+		return
+	}
+
+	spec.Daemon.Nodes = daemonNodes
+	spec.NumInstances = len(daemonNodes)
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{fmt.Sprintf("Start to schedule daemon from %v to %v", curNodes, daemonNodes)}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	for _, instanceNo := range left {
+		pgCtrl.opsChan <- pgOperRemoveInstance{instanceNo, spec.Pod}
+	}
+	var filled []int
+	for i := 0; i < len(curNodes) && i < len(daemonNodes); i += 1 {
+		if daemonNodes[i] != curNodes[i] {
+			pgCtrl.opsChan <- pgOperSetDaemonNode{i + 1, daemonNodes[i]}
+			if daemonNodes[i] != "" {
+				filled = append(filled, i+1)
+			}
+		}
+	}
+	for i := len(daemonNodes); i < len(curNodes); i += 1 {
+		pgCtrl.opsChan <- pgOperPopPodCtrl{}
+	}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	for _, instanceNo := range filled {
+		pgCtrl.opsChan <- pgOperDeployInstance{instanceNo, spec.Version}
+	}
+	for instanceNo := len(curNodes) + 1; instanceNo <= len(daemonNodes); instanceNo += 1 {
+		pgCtrl.opsChan <- pgOperPushPodCtrl{spec.Pod}
+		pgCtrl.opsChan <- pgOperDeployInstance{instanceNo, spec.Version}
+	}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Schedule daemon finished"}
+}
+
+// scheduleDaemons checks the nodes of the daemon pod groups, it runs periodically beside the operation worker
+func (engine *OrcEngine) scheduleDaemons() {
+	nodes, err := engine.cluster.GetResources()
+	if err != nil {
+		log.Warnf("<OrcEngine> Cannot get the nodes for the daemons, %s", err)
+		return
+	}
+	engine.RLock()
+	defer engine.RUnlock()
+	for name, pgCtrl := range engine.pgCtrls {
+		if !pgCtrl.IsDaemon() || pgCtrl.IsStopped() || pgCtrl.IsPending() {
+			continue
+		}
+		pgCtrl.RLock()
+		spec := pgCtrl.spec
+		pgCtrl.RUnlock()
+		daemonNodes := eligibleDaemonNodes(nodes, spec.Pod)
+		if activeNodes := spec.Daemon.ActiveNodes(); !stringSetEquals(daemonNodes, activeNodes) {
+			log.Infof("<OrcEngine> Nodes of daemon %s changed from %v to %v", name, activeNodes, daemonNodes)
+			engine.trackPodGroupOperation("daemon", name, pgCtrl, orcOperScheduleDaemon{pgCtrl, daemonNodes})
+		}
+	}
+}
+
+func stringSetEquals(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool)
+	for _, s := range a {
+		set[s] = true
+	}
+	for _, s := range b {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/mijia/go-generics"
+)
+
+func TestDaemonSlots(t *testing.T) {
+	tests := []struct {
+		curNodes []string
+		nodes    []string
+		slots    []string
+		left     []int
+	}{
+		{nil, []string{"node1", "node2"}, []string{"node1", "node2"}, nil},
+		{[]string{"node1", "node2"}, []string{"node1", "node2"}, []string{"node1", "node2"}, nil},
+		// the node keeps its instance number, the order of the nodes does not matter
+		{[]string{"node2", "node1"}, []string{"node1", "node2"}, []string{"node2", "node1"}, nil},
+		// the left node leaves its slot vacant
+		{[]string{"node1", "node2", "node3"}, []string{"node1", "node3"}, []string{"node1", "", "node3"}, []int{2}},
+		// the joined node takes the vacant slot first, then gets a new slot
+		{[]string{"node1", "", "node3"}, []string{"node1", "node3", "node4"}, []string{"node1", "node4", "node3"}, nil},
+		{[]string{"node1", "node2", "node3"}, []string{"node1", "node3", "node4", "node5"},
+			[]string{"node1", "node4", "node3", "node5"}, []int{2}},
+		// the vacant slots at the end are dropped
+		{[]string{"node1", "node2", "node3"}, []string{"node1"}, []string{"node1"}, []int{2, 3}},
+		{[]string{"node1", "", "node3"}, []string{"node1"}, []string{"node1"}, []int{3}},
+		{[]string{"node1", "node2"}, nil, []string{}, []int{1, 2}},
+	}
+	for i, test := range tests {
+		slots, left := daemonSlots(test.curNodes, test.nodes)
+		if !generics.Equal_StringSlice(slots, test.slots) {
+			t.Errorf("Case %d should have the slots %q, got %q", i, test.slots, slots)
+		}
+		if !generics.Equal_IntSlice(left, test.left) {
+			t.Errorf("Case %d should leave %v, got %v", i, test.left, left)
+		}
+	}
+}
@@ -40,9 +40,10 @@ func (podCtrl *sharedPodController) String() string {
 
 type dependsController struct {
 	sync.RWMutex
-	spec         PodSpec
-	podCtrls     map[string]map[string]*sharedPodController // [node][namespace]podCtrl
-	removeStatus int
+	spec             PodSpec
+	podCtrls         map[string]map[string]*sharedPodController // [node][namespace]podCtrl
+	removeStatus     int
+	runningOperation string // the id of the tracked operation being executed
 
 	Publisher
 	evSnapshot    []RuntimeEaglePod
@@ -235,12 +236,12 @@ func (depCtrl *dependsController) specifyPodSpec(spec PodSpec, nodeName, namespa
 	spec.Name = fmt.Sprintf("%s-%s-%s", spec.Name, nodeName, namespace)
 	newFilters := make([]string, 0, len(spec.Filters))
 	for _, filter := range spec.Filters {
-		if strings.HasPrefix(filter, "constraint:node==") {
+		if isNodeFilter(filter) {
 			continue
 		}
 		newFilters = append(newFilters, filter)
 	}
-	newFilters = append(newFilters, fmt.Sprintf("constraint:node==%s", nodeName))
+	newFilters = append(newFilters, nodeFilter(nodeName, true))
 	spec.Filters = newFilters
 	return spec
 }
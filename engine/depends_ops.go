@@ -263,7 +263,7 @@ func (op depOperDeployInstance) Do(depCtrl *dependsController, c cluster.Cluster
 
 	if !foundDeployed {
 		podCtrl.pod.State = RunStatePending
-		podCtrl.Deploy(c)
+		podCtrl.Deploy(c, nil)
 		if podCtrl.pod.State == RunStateSuccess {
 			depCtrl.emitChangeEvent("add", newSpec, podCtrl.pod.Clone())
 		}
@@ -372,7 +372,7 @@ func (op depOperRefreshInstance) Do(depCtrl *dependsController, c cluster.Cluste
 		return false
 	}
 
-	if podCtrl.pod.NeedRestart(RestartPolicyAlways) && !podCtrl.pod.RestartEnoughTimes() {
+	if podCtrl.pod.NeedRestart(RestartPolicyAlways) && !podCtrl.pod.RestartEnoughTimes(RestartMaxCount) {
 		log.Warnf("DependsCtrl %s, we found pod down, just restart it", op.spec)
 		podCtrl.Start(c)
 		runtime = podCtrl.pod.ImRuntime
@@ -505,5 +505,47 @@ func (op depOperPurge) Do(depCtrl *dependsController, c cluster.Cluster, store s
 	depCtrl.Lock()
 	defer depCtrl.Unlock()
 	depCtrl.removeStatus = 1
+	depCtrl.finishOperation(depCtrl.runningOperation)
 	return true
 }
+
+type depOperBeginOperation struct {
+	opId string
+}
+
+func (op depOperBeginOperation) Do(depCtrl *dependsController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	depCtrl.Lock()
+	defer depCtrl.Unlock()
+	depCtrl.runningOperation = op.opId
+	opsTracker.Start(op.opId)
+	return false
+}
+
+type depOperEndOperation struct {
+	opId string
+}
+
+func (op depOperEndOperation) Do(depCtrl *dependsController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	depCtrl.Lock()
+	defer depCtrl.Unlock()
+	depCtrl.finishOperation(op.opId)
+	return false
+}
+
+// finishOperation marks the running operation finished, should be called with the lock held
+func (depCtrl *dependsController) finishOperation(opId string) {
+	if opId == "" || depCtrl.runningOperation != opId {
+		return
+	}
+	var errMsg string
+	for _, nsPodCtrls := range depCtrl.podCtrls {
+		for _, podCtrl := range nsPodCtrls {
+			pod := podCtrl.pod
+			if pod.State == RunStateFail && pod.LastError != "" {
+				errMsg = fmt.Sprintf("%s: %s", podCtrl.spec.Namespace, pod.LastError)
+			}
+		}
+	}
+	opsTracker.Finish(opId, nil, errMsg)
+	depCtrl.runningOperation = ""
+}
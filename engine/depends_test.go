@@ -1,5 +1,10 @@
+//go:build integration
+// +build integration
+
 package engine
 
+// the tests need the etcd and the swarm cluster below, run them by go test -tags integration
+
 import (
 	"fmt"
 	"testing"
@@ -21,7 +26,7 @@ func TestDependsPodCtrl(t *testing.T) {
 	publisher.AddListener(engine)
 
 	podSpec := createPodSpec("hello", "hello.portal")
-	if err := engine.NewDependencyPod(podSpec); err != nil {
+	if _, err := engine.NewDependencyPod(podSpec); err != nil {
 		t.Errorf("Cannot create dependency pod, %s", err)
 	}
 
@@ -51,7 +56,7 @@ func TestDependsPodCtrl(t *testing.T) {
 
 	podSpec = podSpec.Clone()
 	podSpec.Containers[0].MemoryLimit = 20 * 1024 * 1024
-	if err := engine.UpdateDependencyPod(podSpec); err != nil {
+	if _, err := engine.UpdateDependencyPod(podSpec); err != nil {
 		t.Errorf("Cannot update the depends pod, %s", err)
 	}
 	time.Sleep(30 * time.Second)
@@ -68,7 +73,7 @@ func TestDependsPodCtrl(t *testing.T) {
 	time.Sleep(10 * time.Minute)
 
 	fmt.Println("==========================\n\n")
-	if err := engine.RemoveDependencyPod("hello.portal", true); err != nil {
+	if _, err := engine.RemoveDependencyPod("hello.portal", true); err != nil {
 		t.Errorf("Cannot remove the depends pods, %s", err)
 	}
 	time.Sleep(30 * time.Second)
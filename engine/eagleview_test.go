@@ -1,5 +1,10 @@
+//go:build integration
+// +build integration
+
 package engine
 
+// the tests need the etcd and the swarm cluster below, run them by go test -tags integration
+
 import (
 	"fmt"
 	"testing"
@@ -16,12 +21,12 @@ func TestEagleViewRefresh(t *testing.T) {
 	isDebug := true
 
 	log.EnableDebug()
-	store, err := etcd.NewStore(etcdAddr, isDebug)
+	_, err := etcd.NewStore(etcdAddr, isDebug)
 	if err != nil {
 		t.Errorf("Cannot init the etcd storage")
 	}
 
-	kluster, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, nm, isDebug)
+	kluster, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, isDebug)
 	if err != nil {
 		t.Errorf("Cannot init the swarm cluster manager")
 	}
@@ -8,12 +8,14 @@ import (
 	"time"
 
 	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/scheduler"
 	"github.com/laincloud/deployd/storage"
 	"github.com/mijia/adoc"
 	"github.com/mijia/sweb/log"
 )
 
 var RefreshInterval int
+var RevisionHistoryLimit = 10
 
 var cstController *constraintController
 
@@ -28,6 +30,28 @@ var (
 	ErrDependencyPodNotExists = errors.New("DependencyPod not existed")
 	ErrConstraintNotExists    = errors.New("Constraint not existed")
 	ErrNotifyNotExists        = errors.New("Notify uri not existed")
+	ErrCanaryInProgress       = errors.New("PodGroup has a canary in progress, need to promote or abort it first")
+	ErrCanaryNotExists        = errors.New("PodGroup canary not existed")
+	ErrCanaryInstancesInvalid = errors.New("Canary instances should be more than 0 and less than the PodGroup instances")
+	ErrRevisionNotExists      = errors.New("PodGroup revision not existed")
+	ErrPodGroupStopped        = errors.New("PodGroup is stopped, need to start it first")
+	ErrNodeTopologyNotExists  = errors.New("Node topology not existed")
+	ErrQuotaExceeded          = errors.New("Namespace quota exceeded")
+	ErrQuotaNotExists         = errors.New("Quota not existed")
+	ErrPodGroupIsJob          = errors.New("PodGroup is a job, it cannot be rescheduled")
+	ErrPodGroupIsDaemon       = errors.New("PodGroup is a daemon, its instances follow the nodes")
+	ErrInstanceNotExists      = errors.New("PodGroup instance not existed")
+	ErrInstanceRunning        = errors.New("PodGroup instance is running, only the lost one can be recreated")
+	ErrVolumeNotExists        = errors.New("Volume not existed")
+	ErrVolumeInUse            = errors.New("Volume is in use, only the released one can be cleaned")
+	ErrSecretNotExists        = errors.New("Secret not existed")
+	ErrSecretInUse            = errors.New("Secret is referenced by some pods, need to remove the references first")
+	ErrSecretKeyMissing       = errors.New("Secret master key is not set")
+	ErrSecretCorrupted        = errors.New("Secret cannot be decrypted with the master key")
+	ErrConfigNotExists        = errors.New("Config not existed")
+	ErrConfigInUse            = errors.New("Config is mounted by some pods, need to remove the mounts first")
+	ErrConfigVersionNotExists = errors.New("Config version not existed, it is dropped from the config history")
+	ErrHostnameTooLong        = errors.New("Hostname of the ordered instance would be longer than 63 characters")
 )
 
 type OrcEngine struct {
@@ -67,23 +91,35 @@ func (engine *OrcEngine) HandleEvent(payload interface{}) {
 		}
 		return
 	}
+	if event, ok := payload.(VolumeEvent); ok {
+		engine.RLock()
+		defer engine.RUnlock()
+		// the late events of the removed instances should not take the released volumes back
+		if pgCtrl, ok := engine.pgCtrls[event.Spec.Name]; ok && event.InstanceNo <= pgCtrl.Inspect().Spec.NumInstances {
+			volController.Track(event, engine.store)
+		}
+		return
+	}
 }
 
-func (engine *OrcEngine) NewDependencyPod(spec PodSpec) error {
+func (engine *OrcEngine) NewDependencyPod(spec PodSpec) (string, error) {
 	engine.Lock()
 	defer engine.Unlock()
 
 	if _, ok := engine.dependsCtrls[spec.Name]; ok {
-		return ErrDependencyPodExists
+		return "", ErrDependencyPodExists
 	}
 	if _, ok := engine.rmDepCtrls[spec.Name]; ok {
-		return ErrDependencyPodExists
+		return "", ErrDependencyPodExists
+	}
+	spec, err := pinConfigVersions(spec, spec.Namespace)
+	if err != nil {
+		return "", err
 	}
 
 	depCtrl := engine.initDependsCtrl(spec, nil)
 	engine.dependsCtrls[spec.Name] = depCtrl
-	engine.opsChan <- orcOperDependsAddSpec{depCtrl}
-	return nil
+	return engine.trackDependsOperation("depends.add", spec.Name, depCtrl, orcOperDependsAddSpec{depCtrl}), nil
 }
 
 func (engine *OrcEngine) GetDependencyPod(name string) (NamespacePodsWithSpec, error) {
@@ -97,44 +133,62 @@ func (engine *OrcEngine) GetDependencyPod(name string) (NamespacePodsWithSpec, e
 	}
 }
 
-func (engine *OrcEngine) UpdateDependencyPod(spec PodSpec) error {
+func (engine *OrcEngine) UpdateDependencyPod(spec PodSpec) (string, error) {
 	engine.RLock()
 	defer engine.RUnlock()
 	if depCtrl, ok := engine.dependsCtrls[spec.Name]; !ok {
-		return ErrDependencyPodNotExists
+		return "", ErrDependencyPodNotExists
 	} else {
-		engine.opsChan <- orcOperDependsUpdateSpec{depCtrl, spec}
-		return nil
+		spec, err := pinConfigVersions(spec, spec.Namespace)
+		if err != nil {
+			return "", err
+		}
+		return engine.trackDependsOperation("depends.update", spec.Name, depCtrl, orcOperDependsUpdateSpec{depCtrl, spec}), nil
+	}
+}
+
+func (engine *OrcEngine) PlanDependencyPod(spec PodSpec) (Plan, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if depCtrl, ok := engine.dependsCtrls[spec.Name]; !ok {
+		return Plan{}, ErrDependencyPodNotExists
+	} else {
+		spec, err := pinConfigVersions(spec, spec.Namespace)
+		if err != nil {
+			return Plan{}, err
+		}
+		return depCtrl.PlanSpec(spec), nil
 	}
 }
 
-func (engine *OrcEngine) RemoveDependencyPod(name string, force bool) error {
+func (engine *OrcEngine) RemoveDependencyPod(name string, force bool) (string, error) {
 	engine.Lock()
 	defer engine.Unlock()
 	if depCtrl, ok := engine.dependsCtrls[name]; !ok {
-		return ErrDependencyPodNotExists
+		return "", ErrDependencyPodNotExists
 	} else {
-		engine.opsChan <- orcOperDependsRemoveSpec{depCtrl, force}
+		opId := engine.trackDependsOperation("depends.remove", name, depCtrl, orcOperDependsRemoveSpec{depCtrl, force})
 		delete(engine.dependsCtrls, name)
 		engine.rmDepCtrls[name] = depCtrl
 		go engine.checkDependsRemoveResult(name, depCtrl)
-		return nil
+		return opId, nil
 	}
-	return nil
+	return "", nil
 }
 
 func (engine *OrcEngine) GetNodes() ([]cluster.Node, error) {
 	return engine.cluster.GetResources()
 }
 
-func (engine *OrcEngine) NewPodGroup(spec PodGroupSpec) error {
+func (engine *OrcEngine) NewPodGroup(spec PodGroupSpec) (string, error) {
+	nodes, nodesErr := engine.admissionNodes()
 	engine.Lock()
 	defer engine.Unlock()
 	if _, ok := engine.pgCtrls[spec.Name]; ok {
-		return ErrPodGroupExists
+		return "", ErrPodGroupExists
 	}
 	if _, ok := engine.rmPgCtrls[spec.Name]; ok {
-		return ErrPodGroupCleaning
+		return "", ErrPodGroupCleaning
 	}
 
 	for _, depends := range spec.Pod.Dependencies {
@@ -145,12 +199,31 @@ func (engine *OrcEngine) NewPodGroup(spec PodGroupSpec) error {
 		}
 	}
 
+	if podSpec, err := pinConfigVersions(spec.Pod, spec.Namespace); err != nil {
+		return "", err
+	} else {
+		spec.Pod = podSpec
+	}
+	if spec.IsDaemon() {
+		if nodesErr != nil {
+			return "", nodesErr
+		}
+		daemon := DaemonSpec{Nodes: eligibleDaemonNodes(nodes, spec.Pod)}
+		spec.Daemon = &daemon
+		spec.NumInstances = len(daemon.Nodes)
+	}
+	if qe := checkQuota(engine.quotaUsage(spec.Namespace), podGroupResources(spec)); qe != nil {
+		return "", qe
+	}
+	if err := engine.admit(nodes, spec.Pod, spec.NumInstances, nil); err != nil {
+		return "", err
+	}
+
 	var pg PodGroup
 	pg.State = RunStatePending
 	pgCtrl := engine.initPodGroupCtrl(spec, nil, pg)
 	engine.pgCtrls[spec.Name] = pgCtrl
-	engine.opsChan <- orcOperDeploy{pgCtrl}
-	return nil
+	return engine.trackPodGroupOperation("deploy", spec.Name, pgCtrl, orcOperDeploy{pgCtrl}), nil
 }
 
 func (engine *OrcEngine) InspectPodGroup(name string) (PodGroupWithSpec, bool) {
@@ -159,7 +232,16 @@ func (engine *OrcEngine) InspectPodGroup(name string) (PodGroupWithSpec, bool) {
 	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
 		return PodGroupWithSpec{}, false
 	} else {
-		return pgCtrl.Inspect(), true
+		pgWithSpec := pgCtrl.Inspect()
+		if spread := pgWithSpec.Spec.TopologySpread; spread.IsEnabled() {
+			nodeNames := make([]string, len(pgWithSpec.Pods))
+			for i, pod := range pgWithSpec.Pods {
+				nodeNames[i] = pod.NodeName()
+			}
+			skew := calcTopologySkew(spread, topoController.Domains(spread.Key), nodeNames)
+			pgWithSpec.Topology = &skew
+		}
+		return pgWithSpec, true
 	}
 }
 
@@ -174,36 +256,76 @@ func (engine *OrcEngine) RefreshPodGroup(name string, forceUpdate bool) error {
 	}
 }
 
-func (engine *OrcEngine) RemovePodGroup(name string) error {
+func (engine *OrcEngine) RemovePodGroup(name string) (string, error) {
 	engine.Lock()
 	defer engine.Unlock()
 	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
-		return ErrPodGroupNotExists
+		return "", ErrPodGroupNotExists
 	} else {
-		engine.opsChan <- orcOperRemove{pgCtrl}
+		if pgCtrl.IsCron() {
+			engine.removeCronRuns(pgCtrl)
+		}
+		opId := engine.trackPodGroupOperation("remove", name, pgCtrl, orcOperRemove{pgCtrl})
 		delete(engine.pgCtrls, name)
 		engine.rmPgCtrls[name] = pgCtrl
 		go engine.checkPodGroupRemoveResult(name, pgCtrl)
-		return nil
+		volController.Release(name, 0, pgCtrl.Inspect().Spec.VolumeRetention, engine.store)
+		return opId, nil
 	}
 }
 
-func (engine *OrcEngine) RescheduleInstance(name string, numInstances int, restartPolicy ...RestartPolicy) error {
-	engine.RLock()
-	defer engine.RUnlock()
+func (engine *OrcEngine) RescheduleInstance(name string, numInstances int, restartPolicy ...RestartPolicy) (string, error) {
+	nodes, _ := engine.admissionNodes()
+	// the quota is checked and reserved under the write lock, so the requests are serialized
+	engine.Lock()
+	defer engine.Unlock()
 	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
-		return ErrPodGroupNotExists
+		return "", ErrPodGroupNotExists
 	} else {
-		engine.opsChan <- orcOperRescheduleInstance{pgCtrl, numInstances, restartPolicy}
-		return nil
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if pgCtrl.IsJob() {
+			return "", ErrPodGroupIsJob
+		}
+		spec := pgCtrl.Inspect().Spec
+		if spec.IsDaemon() && numInstances != spec.NumInstances {
+			return "", ErrPodGroupIsDaemon
+		}
+		if !spec.VerifyHostnames(numInstances) {
+			return "", ErrHostnameTooLong
+		}
+		reserved := quotaSpec(pgCtrl)
+		newSpec := reserved
+		newSpec.NumInstances = numInstances
+		requested := podGroupResources(newSpec).Sub(podGroupResources(reserved))
+		if qe := checkQuota(engine.quotaUsage(spec.Namespace), requested); qe != nil {
+			return "", qe
+		}
+		usedNodes := make(map[string]bool)
+		for _, pod := range pgCtrl.Inspect().Pods {
+			if nodeName := pod.NodeName(); nodeName != "" {
+				usedNodes[nodeName] = true
+			}
+		}
+		if err := engine.admit(nodes, spec.Pod, numInstances-spec.NumInstances, usedNodes); err != nil {
+			return "", err
+		}
+		if numInstances >= 0 && numInstances < spec.NumInstances {
+			volController.Release(name, numInstances, spec.VolumeRetention, engine.store)
+		}
+		seq := qtController.Reserve(newSpec)
+		return engine.trackPodGroupOperation("replica", name, pgCtrl,
+			orcOperQuotaReserved{name, seq, orcOperRescheduleInstance{pgCtrl, numInstances, restartPolicy}}), nil
 	}
 }
 
-func (engine *OrcEngine) RescheduleSpec(name string, podSpec PodSpec) error {
-	engine.RLock()
-	defer engine.RUnlock()
+func (engine *OrcEngine) RescheduleSpec(name string, podSpec PodSpec, strategy ...RollingUpdateStrategy) (string, error) {
+	nodes, _ := engine.admissionNodes()
+	engine.Lock()
+	defer engine.Unlock()
 	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
-		return ErrPodGroupNotExists
+		return "", ErrPodGroupNotExists
 	} else {
 		for _, depends := range podSpec.Dependencies {
 			if _, ok := engine.dependsCtrls[depends.PodName]; !ok {
@@ -212,8 +334,249 @@ func (engine *OrcEngine) RescheduleSpec(name string, podSpec PodSpec) error {
 				log.Warnf("Engine found some missing dependency pod, %s", depends.PodName)
 			}
 		}
-		engine.opsChan <- orcOperRescheduleSpec{pgCtrl, podSpec}
-		return nil
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if pgCtrl.HasCanary() {
+			return "", ErrCanaryInProgress
+		}
+		if pgCtrl.IsJob() {
+			return "", ErrPodGroupIsJob
+		}
+		spec := pgCtrl.Inspect().Spec
+		podSpec, err := pinConfigVersions(podSpec, spec.Namespace)
+		if err != nil {
+			return "", err
+		}
+		reserved := quotaSpec(pgCtrl)
+		newSpec := reserved
+		newSpec.Pod = reserved.Pod.Merge(podSpec)
+		requested := podGroupResources(newSpec).Sub(podGroupResources(reserved))
+		if qe := checkQuota(engine.quotaUsage(spec.Namespace), requested); qe != nil {
+			return "", qe
+		}
+		rollout := newSpec
+		if len(strategy) > 0 {
+			rollout.RollingUpdate = strategy[0]
+		}
+		surge, _ := rollout.RolloutBatch(spec.NumInstances, spec.Pod, newSpec.Pod)
+		usedNodes := make(map[string]bool)
+		for _, pod := range pgCtrl.Inspect().Pods {
+			if nodeName := pod.NodeName(); nodeName != "" {
+				usedNodes[nodeName] = true
+			}
+		}
+		if err := engine.admitSpec(nodes, spec.Pod, newSpec.Pod, spec.NumInstances, surge, usedNodes); err != nil {
+			return "", err
+		}
+		seq := qtController.Reserve(newSpec)
+		return engine.trackPodGroupOperation("spec", name, pgCtrl,
+			orcOperQuotaReserved{name, seq, orcOperRescheduleSpec{pgCtrl, podSpec, strategy}}), nil
+	}
+}
+
+// RecreateInstance deploys the lost instance again on its pinned node, it is left alone by the refresh
+// if the pod is hard stateful
+func (engine *OrcEngine) RecreateInstance(name string, instanceNo int) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if pgCtrl.IsJob() {
+			return "", ErrPodGroupIsJob
+		}
+		pg := pgCtrl.Inspect()
+		if instanceNo < 1 || instanceNo > pg.Spec.NumInstances {
+			return "", ErrInstanceNotExists
+		}
+		if instanceNo <= len(pg.Pods) && pg.Pods[instanceNo-1].State == RunStateSuccess {
+			return "", ErrInstanceRunning
+		}
+		return engine.trackPodGroupOperation("recreate", name, pgCtrl, orcOperRecreateInstance{pgCtrl, instanceNo}), nil
+	}
+}
+
+// PlanPodGroupSpec returns what RescheduleSpec would do with the new pod spec, without scheduling it
+func (engine *OrcEngine) PlanPodGroupSpec(name string, podSpec PodSpec, strategy ...RollingUpdateStrategy) (Plan, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return Plan{}, ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return Plan{}, ErrPodGroupStopped
+		}
+		if pgCtrl.HasCanary() {
+			return Plan{}, ErrCanaryInProgress
+		}
+		podSpec, err := pinConfigVersions(podSpec, pgCtrl.Inspect().Spec.Namespace)
+		if err != nil {
+			return Plan{}, err
+		}
+		return pgCtrl.PlanSpec(podSpec, strategy...), nil
+	}
+}
+
+func (engine *OrcEngine) StopPodGroup(name string) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		return engine.trackPodGroupOperation("stop", name, pgCtrl, orcOperStop{pgCtrl}), nil
+	}
+}
+
+func (engine *OrcEngine) StartPodGroup(name string) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		return engine.trackPodGroupOperation("start", name, pgCtrl, orcOperStart{pgCtrl}), nil
+	}
+}
+
+func (engine *OrcEngine) PausePodGroup(name string) (string, error) {
+	return engine.setPodGroupPaused(name, "pause", true)
+}
+
+func (engine *OrcEngine) ResumePodGroup(name string) (string, error) {
+	return engine.setPodGroupPaused(name, "resume", false)
+}
+
+func (engine *OrcEngine) setPodGroupPaused(name string, opType string, paused bool) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		return engine.trackPodGroupOperation(opType, name, pgCtrl, orcOperSetPaused{pgCtrl, paused}), nil
+	}
+}
+
+func (engine *OrcEngine) PodGroupHistory(name string) ([]PodGroupRevision, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return nil, ErrPodGroupNotExists
+	} else {
+		return pgCtrl.History(engine.store)
+	}
+}
+
+func (engine *OrcEngine) RollbackPodGroup(name string, revision int) (string, error) {
+	engine.Lock()
+	defer engine.Unlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if pgCtrl.HasCanary() {
+			return "", ErrCanaryInProgress
+		}
+		if pgCtrl.IsJob() {
+			return "", ErrPodGroupIsJob
+		}
+		revisions, err := pgCtrl.History(engine.store)
+		if err != nil {
+			return "", err
+		}
+		for _, r := range revisions {
+			if r.Revision == revision {
+				if !configVersionsExist(r.Pod, pgCtrl.Inspect().Spec.Namespace) {
+					return "", ErrConfigVersionNotExists
+				}
+				reserved := quotaSpec(pgCtrl)
+				newSpec := reserved
+				newSpec.Pod = reserved.Pod.Merge(r.Pod)
+				requested := podGroupResources(newSpec).Sub(podGroupResources(reserved))
+				if qe := checkQuota(engine.quotaUsage(reserved.Namespace), requested); qe != nil {
+					return "", qe
+				}
+				seq := qtController.Reserve(newSpec)
+				return engine.trackPodGroupOperation("rollback", name, pgCtrl,
+					orcOperQuotaReserved{name, seq, orcOperRescheduleSpec{pgCtrl, r.Pod, nil}}), nil
+			}
+		}
+		return "", ErrRevisionNotExists
+	}
+}
+
+func (engine *OrcEngine) StartCanary(name string, podSpec PodSpec, numInstances int) (string, error) {
+	engine.Lock()
+	defer engine.Unlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if pgCtrl.HasCanary() {
+			return "", ErrCanaryInProgress
+		}
+		if pgCtrl.IsJob() {
+			return "", ErrPodGroupIsJob
+		}
+		spec := pgCtrl.Inspect().Spec
+		if numInstances <= 0 || numInstances >= spec.NumInstances {
+			return "", ErrCanaryInstancesInvalid
+		}
+		podSpec, err := pinConfigVersions(podSpec, spec.Namespace)
+		if err != nil {
+			return "", err
+		}
+		reserved := quotaSpec(pgCtrl)
+		newSpec := reserved
+		newSpec.Canary = &CanarySpec{
+			Pod:          reserved.Pod.Merge(podSpec),
+			NumInstances: numInstances,
+		}
+		requested := podGroupResources(newSpec).Sub(podGroupResources(reserved))
+		if qe := checkQuota(engine.quotaUsage(spec.Namespace), requested); qe != nil {
+			return "", qe
+		}
+		seq := qtController.Reserve(newSpec)
+		return engine.trackPodGroupOperation("canary", name, pgCtrl,
+			orcOperQuotaReserved{name, seq, orcOperStartCanary{pgCtrl, podSpec, numInstances}}), nil
+	}
+}
+
+func (engine *OrcEngine) PromoteCanary(name string) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if !pgCtrl.HasCanary() {
+			return "", ErrCanaryNotExists
+		}
+		return engine.trackPodGroupOperation("promote", name, pgCtrl, orcOperPromoteCanary{pgCtrl}), nil
+	}
+}
+
+func (engine *OrcEngine) AbortCanary(name string) (string, error) {
+	engine.RLock()
+	defer engine.RUnlock()
+	if pgCtrl, ok := engine.pgCtrls[name]; !ok {
+		return "", ErrPodGroupNotExists
+	} else {
+		if pgCtrl.IsStopped() {
+			return "", ErrPodGroupStopped
+		}
+		if !pgCtrl.HasCanary() {
+			return "", ErrCanaryNotExists
+		}
+		return engine.trackPodGroupOperation("abort", name, pgCtrl, orcOperAbortCanary{pgCtrl}), nil
 	}
 }
 
@@ -227,6 +590,10 @@ func (engine *OrcEngine) Start() {
 	}
 	engine.stop = make(chan struct{})
 	go engine.initOperationWorker()
+	go engine.runPeriodically(engine.stop, RefreshInterval, engine.removeExpiredJobs)
+	go engine.runPeriodically(engine.stop, CronCheckInterval, engine.scheduleCronJobs)
+	go engine.runPeriodically(engine.stop, RefreshInterval, engine.scheduleDaemons)
+	go engine.runPeriodically(engine.stop, RefreshInterval, engine.cleanVolumes)
 	go engine.startClusterMonitor()
 }
 
@@ -377,6 +744,38 @@ func (engine *OrcEngine) initOperationWorker() {
 	}
 }
 
+// runPeriodically runs the pass on its own goroutine until the engine is stopped. The pass queues the operations
+// into engine.opsChan, so it cannot run on the operation worker, which would block on itself once the queue is full.
+func (engine *OrcEngine) runPeriodically(stop chan struct{}, interval int, pass func()) {
+	tick := time.Tick(time.Duration(interval) * time.Second)
+	for {
+		select {
+		case <-tick:
+			pass()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// removeExpiredJobs removes the finished jobs which have been kept longer than their TTL
+func (engine *OrcEngine) removeExpiredJobs() {
+	var names []string
+	engine.RLock()
+	for name, pgCtrl := range engine.pgCtrls {
+		if pgCtrl.IsJobExpired() {
+			names = append(names, name)
+		}
+	}
+	engine.RUnlock()
+	for _, name := range names {
+		log.Infof("<OrcEngine> Job %s is finished and expired, will remove it", name)
+		if _, err := engine.RemovePodGroup(name); err != nil {
+			log.Warnf("<OrcEngine> Cannot remove the expired job %s, %s", name, err)
+		}
+	}
+}
+
 // This will be running inside the go routine
 func (engine *OrcEngine) checkDependsRemoveResult(name string, depCtrl *dependsController) {
 	tick := time.Tick(5 * time.Second)
@@ -423,21 +822,47 @@ func (engine *OrcEngine) checkPodGroupRemoveResult(name string, pgCtrl *podGroup
 	}
 }
 
-func (engine *OrcEngine) DriftNode(fromNode, toNode string, pgName string, pgInstance int, force bool) {
+func (engine *OrcEngine) DriftNode(fromNode, toNode string, pgName string, pgInstance int, force bool) []string {
 	engine.RLock()
 	defer engine.RUnlock()
+	var opIds []string
 	if pgName == "" {
-		for _, pgCtrl := range engine.pgCtrls {
+		for name, pgCtrl := range engine.pgCtrls {
+			if pgCtrl.IsJob() || pgCtrl.IsDaemon() {
+				// the job instances are not drifted, the exited ones would run again,
+				// and the daemon instances are pinned to their nodes
+				continue
+			}
 			_pgCtrl := pgCtrl
-			engine.opsChan <- orcOperScheduleDrift{_pgCtrl, fromNode, toNode, pgInstance, force}
+			opIds = append(opIds, engine.trackPodGroupOperation("drift", name, _pgCtrl,
+				orcOperScheduleDrift{_pgCtrl, fromNode, toNode, pgInstance, force}))
 		}
 	} else {
-		if pgCtrl, ok := engine.pgCtrls[pgName]; ok {
-			engine.opsChan <- orcOperScheduleDrift{pgCtrl, fromNode, toNode, pgInstance, force}
+		if pgCtrl, ok := engine.pgCtrls[pgName]; ok && !pgCtrl.IsJob() && !pgCtrl.IsDaemon() {
+			opIds = append(opIds, engine.trackPodGroupOperation("drift", pgName, pgCtrl,
+				orcOperScheduleDrift{pgCtrl, fromNode, toNode, pgInstance, force}))
 		}
 	}
 	// FIXME: do we need to tell dependsCtrl to drift?
 	// so far we just wait for the dependsCtrl to react to the events
+	return opIds
+}
+
+func (engine *OrcEngine) GetOperation(id string) (Operation, bool) {
+	return opsTracker.Get(id)
+}
+
+// trackPodGroupOperation records a new operation and queues it, returns the operation id
+func (engine *OrcEngine) trackPodGroupOperation(opType string, name string, pgCtrl *podGroupController, op orcOperation) string {
+	opId := opsTracker.New(opType, name)
+	engine.opsChan <- orcOperTracked{opId, pgCtrl, op}
+	return opId
+}
+
+func (engine *OrcEngine) trackDependsOperation(opType string, name string, depCtrl *dependsController, op orcOperation) string {
+	opId := opsTracker.New(opType, name)
+	engine.opsChan <- orcOperDependsTracked{opId, depCtrl, op}
+	return opId
 }
 
 func (engine *OrcEngine) GetConstraints(cstType string) (ConstraintSpec, bool) {
@@ -456,6 +881,204 @@ func (engine *OrcEngine) DeleteConstraints(cstType string) error {
 	}
 }
 
+func (engine *OrcEngine) GetNodeTopologies() []NodeTopology {
+	return topoController.GetAllTopologies()
+}
+
+func (engine *OrcEngine) GetNodeTopology(node string) (NodeTopology, bool) {
+	return topoController.GetTopology(node)
+}
+
+func (engine *OrcEngine) UpdateNodeTopology(topology NodeTopology) error {
+	return topoController.SetTopology(topology, engine.store)
+}
+
+func (engine *OrcEngine) DeleteNodeTopology(node string) error {
+	if _, ok := topoController.GetTopology(node); !ok {
+		return ErrNodeTopologyNotExists
+	} else {
+		return topoController.RemoveTopology(node, engine.store)
+	}
+}
+
+// quotaUsage sums the resources of the pod groups in the namespace, the engine lock should be held
+func (engine *OrcEngine) quotaUsage(namespace string) QuotaUsage {
+	usage := QuotaUsage{Namespace: namespace}
+	if quota, ok := qtController.GetQuota(namespace); ok {
+		usage.Limit = quota.Limit
+		usage.HasQuota = true
+	}
+	for _, pgCtrl := range engine.pgCtrls {
+		if spec := quotaSpec(pgCtrl); spec.Namespace == namespace {
+			usage.Used = usage.Used.Add(podGroupResources(spec))
+		}
+	}
+	return usage
+}
+
+// quotaSpec is the spec of the pod group counted in the quota usage, the reserved one if it is not applied yet
+func quotaSpec(pgCtrl *podGroupController) PodGroupSpec {
+	spec := pgCtrl.Inspect().Spec
+	if reserved, ok := qtController.Reserved(spec.Name); ok {
+		return reserved
+	}
+	return spec
+}
+
+func (engine *OrcEngine) GetQuotaUsage(namespace string) QuotaUsage {
+	engine.RLock()
+	defer engine.RUnlock()
+	return engine.quotaUsage(namespace)
+}
+
+func (engine *OrcEngine) GetQuotaUsages() []QuotaUsage {
+	engine.RLock()
+	defer engine.RUnlock()
+	quotas := qtController.GetAllQuotas()
+	usages := make([]QuotaUsage, len(quotas))
+	for i, quota := range quotas {
+		usages[i] = engine.quotaUsage(quota.Namespace)
+	}
+	return usages
+}
+
+func (engine *OrcEngine) UpdateQuota(quota QuotaSpec) error {
+	return qtController.SetQuota(quota, engine.store)
+}
+
+func (engine *OrcEngine) DeleteQuota(namespace string) error {
+	if _, ok := qtController.GetQuota(namespace); !ok {
+		return ErrQuotaNotExists
+	} else {
+		return qtController.RemoveQuota(namespace, engine.store)
+	}
+}
+
+func (engine *OrcEngine) GetVolumes(name string) []VolumeRecord {
+	return volController.GetVolumes(name)
+}
+
+func (engine *OrcEngine) CleanVolume(name string, instanceNo int, node string) error {
+	return volController.Clean(name, instanceNo, node, engine.store)
+}
+
+func (engine *OrcEngine) GetSecrets(namespace string) []SecretInfo {
+	return scrController.GetSecrets(namespace)
+}
+
+func (engine *OrcEngine) GetSecret(namespace, name string) (SecretInfo, bool) {
+	return scrController.GetSecret(namespace, name)
+}
+
+func (engine *OrcEngine) UpdateSecret(secret SecretSpec) error {
+	return scrController.SetSecret(secret, engine.store)
+}
+
+func (engine *OrcEngine) DeleteSecret(namespace, name string) error {
+	if _, ok := scrController.GetSecret(namespace, name); !ok {
+		return ErrSecretNotExists
+	}
+	engine.RLock()
+	defer engine.RUnlock()
+	for _, pgCtrl := range engine.pgCtrls {
+		if spec := pgCtrl.Inspect().Spec; podSpecUsesSecret(spec.Pod, namespace, name) ||
+			(spec.Canary != nil && podSpecUsesSecret(spec.Canary.Pod, namespace, name)) {
+			return ErrSecretInUse
+		}
+	}
+	for _, depCtrl := range engine.dependsCtrls {
+		if podSpecUsesSecret(depCtrl.Inspect().Spec, namespace, name) {
+			return ErrSecretInUse
+		}
+	}
+	return scrController.RemoveSecret(namespace, name, engine.store)
+}
+
+func (engine *OrcEngine) GetConfigs(namespace string) []ConfigSpec {
+	return cfgController.GetConfigs(namespace)
+}
+
+func (engine *OrcEngine) GetConfig(namespace, name string) (ConfigSpec, bool) {
+	return cfgController.GetConfig(namespace, name)
+}
+
+// UpdateConfig saves the new version of the config, the pod groups mounting it are restarted by the rolling update
+func (engine *OrcEngine) UpdateConfig(config ConfigSpec) error {
+	engine.Lock()
+	defer engine.Unlock()
+	if changed, err := cfgController.SetConfig(config, engine.configVersionsInUse(config.Namespace, config.Name), engine.store); err != nil || !changed {
+		return err
+	}
+	for name, pgCtrl := range engine.pgCtrls {
+		spec := pgCtrl.Inspect().Spec
+		// start from the spec of the accepted updates, so a pending update is not rolled back by the restart
+		reserved := quotaSpec(pgCtrl)
+		if !podSpecUsesConfig(reserved.Pod, config.Namespace, config.Name) {
+			continue
+		}
+		if spec.IsJob() || spec.Stopped || spec.Canary != nil {
+			// the jobs and the cron runs pick up the new version when they are created, the others on their next update
+			log.Infof("<OrcEngine> Config %s/%s changed, leave %s as it is", config.Namespace, config.Name, name)
+			continue
+		}
+		podSpec, err := pinConfigVersions(reserved.Pod, spec.Namespace)
+		if err != nil {
+			log.Warnf("<OrcEngine> Config %s/%s changed, cannot update %s, %s", config.Namespace, config.Name, name, err)
+			continue
+		}
+		newSpec := reserved
+		newSpec.Pod = reserved.Pod.Merge(podSpec)
+		requested := podGroupResources(newSpec).Sub(podGroupResources(reserved))
+		if qe := checkQuota(engine.quotaUsage(spec.Namespace), requested); qe != nil {
+			log.Warnf("<OrcEngine> Config %s/%s changed, cannot update %s, %s", config.Namespace, config.Name, name, qe)
+			continue
+		}
+		log.Infof("<OrcEngine> Config %s/%s changed, restart %s", config.Namespace, config.Name, name)
+		seq := qtController.Reserve(newSpec)
+		engine.trackPodGroupOperation("config", name, pgCtrl,
+			orcOperQuotaReserved{name, seq, orcOperRescheduleSpec{pgCtrl, podSpec, nil}})
+	}
+	return nil
+}
+
+// configVersionsInUse returns the versions of the config mounted by the pods, they are kept in the config history,
+// it should be called with the engine lock held
+func (engine *OrcEngine) configVersionsInUse(namespace, name string) map[int]bool {
+	versions := make(map[int]bool)
+	for _, pgCtrl := range engine.pgCtrls {
+		spec := pgCtrl.Inspect().Spec
+		addConfigVersions(versions, spec.Pod, namespace, name)
+		addConfigVersions(versions, quotaSpec(pgCtrl).Pod, namespace, name)
+		if spec.Canary != nil {
+			addConfigVersions(versions, spec.Canary.Pod, namespace, name)
+		}
+	}
+	for _, depCtrl := range engine.dependsCtrls {
+		addConfigVersions(versions, depCtrl.Inspect().Spec, namespace, name)
+	}
+	return versions
+}
+
+func (engine *OrcEngine) DeleteConfig(namespace, name string) error {
+	if _, ok := cfgController.GetConfig(namespace, name); !ok {
+		return ErrConfigNotExists
+	}
+	engine.RLock()
+	defer engine.RUnlock()
+	for _, pgCtrl := range engine.pgCtrls {
+		if spec := pgCtrl.Inspect().Spec; podSpecUsesConfig(spec.Pod, namespace, name) ||
+			(spec.Canary != nil && podSpecUsesConfig(spec.Canary.Pod, namespace, name)) {
+			return ErrConfigInUse
+		}
+	}
+	for _, depCtrl := range engine.dependsCtrls {
+		if podSpecUsesConfig(depCtrl.Inspect().Spec, namespace, name) {
+			return ErrConfigInUse
+		}
+	}
+	return cfgController.RemoveConfig(namespace, name, engine.store)
+}
+
 func (engine *OrcEngine) GetNotifies() []string {
 	notifies := ntfController.GetAllNotifies()
 	return ntfController.CallbackList(notifies)
@@ -474,7 +1097,7 @@ func (engine *OrcEngine) DeleteNotify(callback string) error {
 }
 
 func (engine *OrcEngine) onClusterNodeLost(nodeName string, downCount int) {
-	log.Warnf("Cluster node is down, [%q], %s nodes down in all, will check if need stop the engine", nodeName, downCount)
+	log.Warnf("Cluster node is down, [%q], %d nodes down in all, will check if need stop the engine", nodeName, downCount)
 	if downCount >= maxDownNode {
 		log.Warnf("Too many cluster nodes stoped in a short period, need stop the engine")
 		engine.Stop()
@@ -541,11 +1164,46 @@ func New(cluster cluster.Cluster, store storage.Store) (*OrcEngine, error) {
 		return nil, err
 	}
 
+	topoController = NewTopologyController()
+	if err := topoController.LoadTopologies(engine.store); err != nil {
+		return nil, err
+	}
+
+	qtController = NewQuotaController()
+	if err := qtController.LoadQuotas(engine.store); err != nil {
+		return nil, err
+	}
+
+	volController = NewVolumeController()
+	if err := volController.LoadVolumes(engine.store); err != nil {
+		return nil, err
+	}
+
+	cfgController = NewConfigController()
+	if err := cfgController.LoadConfigs(engine.store); err != nil {
+		return nil, err
+	}
+
+	scrController = NewSecretController()
+	if err := scrController.LoadSecrets(engine.store); err != nil {
+		return nil, err
+	}
+
 	ntfController = NewNotifyController(engine.stop)
 	if err := ntfController.LoadNotifies(engine.store); err != nil {
 		return nil, err
 	}
 
+	opsTracker = NewOperationTracker(OperationHistoryLimit)
+
+	if SchedulerStrategy != "" {
+		if s, err := scheduler.New(SchedulerStrategy); err != nil {
+			return nil, err
+		} else {
+			podScheduler = s
+		}
+	}
+
 	if err := engine.LoadDependsPods(); err != nil {
 		return nil, err
 	}
@@ -94,13 +94,83 @@ func (op orcOperRescheduleInstance) Do(engine *OrcEngine) {
 	op.pgCtrl.RescheduleInstance(op.numInstances, op.restartPolicy...)
 }
 
+type orcOperScheduleDaemon struct {
+	pgCtrl *podGroupController
+	nodes  []string
+}
+
+func (op orcOperScheduleDaemon) Do(engine *OrcEngine) {
+	op.pgCtrl.ScheduleDaemon(op.nodes)
+}
+
+type orcOperRecreateInstance struct {
+	pgCtrl     *podGroupController
+	instanceNo int
+}
+
+func (op orcOperRecreateInstance) Do(engine *OrcEngine) {
+	op.pgCtrl.RecreateInstance(op.instanceNo)
+}
+
 type orcOperRescheduleSpec struct {
-	pgCtrl  *podGroupController
-	podSpec PodSpec
+	pgCtrl   *podGroupController
+	podSpec  PodSpec
+	strategy []RollingUpdateStrategy
 }
 
 func (op orcOperRescheduleSpec) Do(engine *OrcEngine) {
-	op.pgCtrl.RescheduleSpec(op.podSpec)
+	op.pgCtrl.RescheduleSpec(op.podSpec, op.strategy...)
+}
+
+type orcOperStop struct {
+	pgCtrl *podGroupController
+}
+
+func (op orcOperStop) Do(engine *OrcEngine) {
+	op.pgCtrl.Stop()
+}
+
+type orcOperStart struct {
+	pgCtrl *podGroupController
+}
+
+func (op orcOperStart) Do(engine *OrcEngine) {
+	op.pgCtrl.Start()
+}
+
+type orcOperSetPaused struct {
+	pgCtrl *podGroupController
+	paused bool
+}
+
+func (op orcOperSetPaused) Do(engine *OrcEngine) {
+	op.pgCtrl.SetPaused(op.paused)
+}
+
+type orcOperStartCanary struct {
+	pgCtrl       *podGroupController
+	podSpec      PodSpec
+	numInstances int
+}
+
+func (op orcOperStartCanary) Do(engine *OrcEngine) {
+	op.pgCtrl.StartCanary(op.podSpec, op.numInstances)
+}
+
+type orcOperPromoteCanary struct {
+	pgCtrl *podGroupController
+}
+
+func (op orcOperPromoteCanary) Do(engine *OrcEngine) {
+	op.pgCtrl.PromoteCanary()
+}
+
+type orcOperAbortCanary struct {
+	pgCtrl *podGroupController
+}
+
+func (op orcOperAbortCanary) Do(engine *OrcEngine) {
+	op.pgCtrl.AbortCanary()
 }
 
 type orcOperScheduleDrift struct {
@@ -114,3 +184,40 @@ type orcOperScheduleDrift struct {
 func (op orcOperScheduleDrift) Do(engine *OrcEngine) {
 	op.pgCtrl.RescheduleDrift(op.fromNode, op.toNode, op.instanceNo, op.force)
 }
+
+// orcOperQuotaReserved releases the quota reservation once the spec is applied by the operation
+type orcOperQuotaReserved struct {
+	name string
+	seq  int64
+	op   orcOperation
+}
+
+func (op orcOperQuotaReserved) Do(engine *OrcEngine) {
+	op.op.Do(engine)
+	qtController.Release(op.name, op.seq)
+}
+
+// orcOperTracked wraps the operation on the pod group, records the operation status via the tracker
+type orcOperTracked struct {
+	opId   string
+	pgCtrl *podGroupController
+	op     orcOperation
+}
+
+func (op orcOperTracked) Do(engine *OrcEngine) {
+	op.pgCtrl.opsChan <- pgOperBeginOperation{op.opId}
+	op.op.Do(engine)
+	op.pgCtrl.opsChan <- pgOperEndOperation{op.opId}
+}
+
+type orcOperDependsTracked struct {
+	opId    string
+	depCtrl *dependsController
+	op      orcOperation
+}
+
+func (op orcOperDependsTracked) Do(engine *OrcEngine) {
+	op.depCtrl.opsChan <- depOperBeginOperation{op.opId}
+	op.op.Do(engine)
+	op.depCtrl.opsChan <- depOperEndOperation{op.opId}
+}
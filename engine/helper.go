@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/mijia/adoc"
+	"github.com/mijia/sweb/log"
+)
+
+// HelperImage is the image of the short-lived containers which do the node local work for deployd,
+// e.g. cleaning the volume directories and rendering the config files, it should have sh, tar and cp
+var HelperImage = "busybox"
+
+// HelperTimeout is the seconds to wait for the helper container
+var HelperTimeout = 600
+
+// runHelperContainer runs the command in cc by a helper container and waits for it to exit 0,
+// the container is removed after that. The node is decided by the filters in cc.Env. The tar archive is
+// extracted at "/" of the helper before it is started, the input files never go through the env.
+func runHelperContainer(c cluster.Cluster, cc adoc.ContainerConfig, hc adoc.HostConfig, name string, archive []byte) (adoc.ContainerDetail, error) {
+	var info adoc.ContainerDetail
+	cc.Image = HelperImage
+	hc.NetworkMode = "none"
+	id, err := c.CreateContainer(cc, hc, adoc.NetworkingConfig{}, name)
+	if err != nil {
+		return info, err
+	}
+	defer func() {
+		if err := c.RemoveContainer(id, true, false); err != nil {
+			log.Warnf("Cannot remove the helper container %s, %s", id, err)
+		}
+	}()
+	if archive != nil {
+		if err := c.CopyToContainer(id, "/", archive); err != nil {
+			return info, err
+		}
+	}
+	if err := c.StartContainer(id); err != nil {
+		return info, err
+	}
+	deadline := time.Now().Add(time.Duration(HelperTimeout) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if info, err = c.InspectContainer(id); err != nil {
+			return info, err
+		}
+		if info.State.Running {
+			continue
+		}
+		if info.State.ExitCode != 0 {
+			return info, fmt.Errorf("Helper %s exited with %d, %s", name, info.State.ExitCode, info.State.Error)
+		}
+		return info, nil
+	}
+	return info, fmt.Errorf("Helper %s is not finished in %d seconds", name, HelperTimeout)
+}
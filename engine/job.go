@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/sweb/log"
+)
+
+// jobPodResult checks if all the containers of the pod have exited, the first non zero exit code is returned.
+// The container which never started, e.g. it failed to start in Deploy, is failed with -1.
+func jobPodResult(pod Pod) (bool, int, string) {
+	switch pod.State {
+	case RunStateMissing, RunStateRemoved:
+		return true, -1, pod.LastError
+	case RunStatePending:
+		return false, 0, ""
+	}
+	if len(pod.Containers) == 0 {
+		return true, -1, "No container found"
+	}
+	for _, container := range pod.Containers {
+		if container.Runtime.State.Running {
+			return false, 0, ""
+		}
+	}
+	for _, container := range pod.Containers {
+		state := container.Runtime.State
+		if state.StartedAt.IsZero() {
+			reason := fmt.Sprintf("Container %s never started", container.Id)
+			if pod.LastError != "" {
+				reason = fmt.Sprintf("%s, %s", reason, pod.LastError)
+			}
+			return true, -1, reason
+		}
+		if state.ExitCode != 0 {
+			return true, state.ExitCode, fmt.Sprintf("Container %s exited with %d, %s", container.Id, state.ExitCode, state.Error)
+		}
+	}
+	return true, 0, ""
+}
+
+type pgOperBeginJob struct {
+	numInstances int
+}
+
+func (op pgOperBeginJob) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	if pgCtrl.group.Job != nil {
+		return false
+	}
+	job := &JobStatus{
+		State:     JobStateRunning,
+		StartedAt: time.Now(),
+		Instances: make([]JobInstanceStatus, op.numInstances),
+	}
+	for i := range job.Instances {
+		job.Instances[i].InstanceNo = i + 1
+		job.Instances[i].State = JobStatePending
+	}
+	pgCtrl.group.Job = job
+	return false
+}
+
+// pgOperRefreshJob collects the exited instances, retries the failed ones and starts the pending ones
+// up to the parallelism. Nothing is restarted once the job is finished.
+type pgOperRefreshJob struct {
+	spec PodGroupSpec
+}
+
+func (op pgOperRefreshJob) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.RLock()
+	var job JobStatus
+	if pgCtrl.group.Job != nil {
+		job = pgCtrl.group.Job.Clone()
+	}
+	pgCtrl.RUnlock()
+	if op.spec.Job == nil || job.State == "" || job.IsFinished() {
+		return false
+	}
+
+	start := time.Now()
+	defer func() {
+		pgCtrl.RLock()
+		log.Infof("%s refresh job, state=%s, succeeded=%d, failed=%d, duration=%s",
+			pgCtrl, job.State, job.Succeeded, job.Failed, time.Now().Sub(start))
+		pgCtrl.RUnlock()
+	}()
+
+	running := 0
+	for i := range job.Instances {
+		inst := &job.Instances[i]
+		if inst.State != JobStateRunning || i >= len(pgCtrl.podCtrls) {
+			continue
+		}
+		podCtrl := pgCtrl.podCtrls[i]
+		podCtrl.Refresh(c)
+		done, exitCode, lastError := jobPodResult(podCtrl.pod)
+		if !done {
+			running += 1
+			continue
+		}
+		inst.ExitCode = exitCode
+		inst.LastError = lastError
+		if exitCode == 0 {
+			inst.State = JobStateSucceeded
+			job.Succeeded += 1
+			continue
+		}
+		job.Failed += 1
+		if job.Failed > op.spec.Job.BackoffLimit {
+			inst.State = JobStateFailed
+			job.State = JobStateFailed
+			job.Reason = fmt.Sprintf("Backoff limit %d exceeded, instance %d failed, %s", op.spec.Job.BackoffLimit, inst.InstanceNo, lastError)
+			continue
+		}
+		// remove the failed run and retry it below
+		podCtrl.Remove(c)
+		podCtrl.pod.State = RunStatePending
+		inst.State = JobStatePending
+	}
+
+	deadline := time.Duration(op.spec.Job.ActiveDeadline) * time.Second
+	if job.State == JobStateRunning && deadline > 0 && time.Now().After(job.StartedAt.Add(deadline)) {
+		job.State = JobStateFailed
+		job.Reason = fmt.Sprintf("Active deadline %s exceeded", deadline)
+	}
+
+	switch {
+	case job.State == JobStateFailed:
+		for i := range job.Instances {
+			if inst := &job.Instances[i]; inst.State == JobStateRunning {
+				pgCtrl.podCtrls[i].Stop(c)
+				inst.State = JobStateFailed
+				inst.LastError = job.Reason
+			}
+		}
+	case job.Succeeded == len(job.Instances):
+		job.State = JobStateSucceeded
+	default:
+		parallelism := op.spec.Job.GetParallelism(len(job.Instances))
+		for i := range job.Instances {
+			if running >= parallelism {
+				break
+			}
+			if inst := &job.Instances[i]; inst.State == JobStatePending && i < len(pgCtrl.podCtrls) {
+				if inst.Attempts > 0 {
+					// the eagle view snapshot may still have the removed run
+					pgCtrl.podCtrls[i].Deploy(c, pgCtrl.placements(pgCtrl.podCtrls[i]))
+				} else {
+					deployOp := pgOperDeployInstance{i + 1, op.spec.InstanceVersion(i + 1)}
+					deployOp.Do(pgCtrl, c, store, ev)
+				}
+				inst.State = JobStateRunning
+				inst.Attempts += 1
+				running += 1
+			}
+		}
+	}
+	if job.IsFinished() {
+		job.FinishedAt = time.Now()
+		pgCtrl.RLock()
+		log.Infof("%s job finished, state=%s, reason=%q", pgCtrl, job.State, job.Reason)
+		pgCtrl.RUnlock()
+	}
+
+	pgCtrl.Lock()
+	pgCtrl.group.Job = &job
+	pgCtrl.Unlock()
+	return false
+}
+
+// IsJobExpired returns true if the finished job has been kept longer than its TTL
+func (pgCtrl *podGroupController) IsJobExpired() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	spec, job := pgCtrl.spec.Job, pgCtrl.group.Job
+	if spec == nil || spec.TTLSecondsAfterFinished <= 0 || job == nil || !job.IsFinished() {
+		return false
+	}
+	return time.Now().After(job.FinishedAt.Add(time.Duration(spec.TTLSecondsAfterFinished) * time.Second))
+}
+
+func (pgCtrl *podGroupController) deployJob(spec PodGroupSpec) {
+	pgCtrl.opsChan <- pgOperLogOperation{"Start to deploy job"}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSaveRevision{spec.Version, spec.Pod}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	pgCtrl.opsChan <- pgOperBeginJob{spec.NumInstances}
+	pgCtrl.opsChan <- pgOperRefreshJob{spec}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"deploy job finished"}
+}
+
+func (pgCtrl *podGroupController) refreshJob(spec PodGroupSpec, force bool) {
+	pgCtrl.opsChan <- pgOperLogOperation{"Start to refresh job"}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	pgCtrl.opsChan <- pgOperRefreshJob{spec}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{force}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{false}
+	pgCtrl.opsChan <- pgOperLogOperation{"Job refreshing finished"}
+}
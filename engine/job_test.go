@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc"
+)
+
+func jobTestContainer(id string, state adoc.ContainerState) Container {
+	container := Container{Id: id}
+	container.Runtime.State = state
+	return container
+}
+
+func TestJobPodResult(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	exited := func(code int) adoc.ContainerState {
+		return adoc.ContainerState{StartedAt: started, ExitCode: code, Error: "oops"}
+	}
+	running := adoc.ContainerState{StartedAt: started, Running: true}
+	tests := []struct {
+		pod      Pod
+		finished bool
+		exitCode int
+	}{
+		{Pod{Containers: []Container{jobTestContainer("a", exited(0))}}, true, 0},
+		{Pod{Containers: []Container{jobTestContainer("a", exited(0)), jobTestContainer("b", exited(3))}}, true, 3},
+		// the first non zero exit code is returned
+		{Pod{Containers: []Container{jobTestContainer("a", exited(2)), jobTestContainer("b", exited(3))}}, true, 2},
+		// wait for all the containers to exit
+		{Pod{Containers: []Container{jobTestContainer("a", exited(1)), jobTestContainer("b", running)}}, false, 0},
+		{Pod{Containers: []Container{jobTestContainer("a", adoc.ContainerState{})}}, true, -1},
+		{Pod{}, true, -1},
+	}
+	for i, test := range tests {
+		test.pod.State = RunStateExit
+		finished, exitCode, _ := jobPodResult(test.pod)
+		if finished != test.finished || exitCode != test.exitCode {
+			t.Errorf("Case %d should be finished=%v exitCode=%d, got finished=%v exitCode=%d",
+				i, test.finished, test.exitCode, finished, exitCode)
+		}
+	}
+
+	states := []struct {
+		state    RunState
+		finished bool
+		exitCode int
+	}{
+		{RunStatePending, false, 0},
+		{RunStateMissing, true, -1},
+		{RunStateRemoved, true, -1},
+	}
+	for _, test := range states {
+		pod := Pod{Containers: []Container{jobTestContainer("a", exited(0))}}
+		pod.State = test.state
+		pod.LastError = "lost"
+		finished, exitCode, reason := jobPodResult(pod)
+		if finished != test.finished || exitCode != test.exitCode {
+			t.Errorf("Pod in %s should be finished=%v exitCode=%d, got finished=%v exitCode=%d",
+				test.state, test.finished, test.exitCode, finished, exitCode)
+		}
+		if test.finished && reason != "lost" {
+			t.Errorf("Pod in %s should keep the last error, got %q", test.state, reason)
+		}
+	}
+
+	pod := Pod{Containers: []Container{jobTestContainer("a", adoc.ContainerState{})}}
+	pod.State = RunStateFail
+	pod.LastError = "image not found"
+	if _, _, reason := jobPodResult(pod); reason != "Container a never started, image not found" {
+		t.Errorf("Container never started should report the last error, got %q", reason)
+	}
+}
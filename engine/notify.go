@@ -16,10 +16,13 @@ import (
 )
 
 var (
-	NotifyPodMissing = "LAIN found pod missing, ready to redeployd it"
-	NotifyPodDown    = "LAIN found pod down, ready to restart it"
-	NotifyLetPodGo   = "LAIN found pod restart too many times in a short period, will let it go"
-	NotifyPodIPLost  = "LAIN found pod lost IP, please inform the SA team"
+	NotifyPodMissing   = "LAIN found pod missing, ready to redeployd it"
+	NotifyPodDown      = "LAIN found pod down, ready to restart it"
+	NotifyLetPodGo     = "LAIN found pod restart too many times in a short period, will let it go"
+	NotifyPodIPLost    = "LAIN found pod lost IP, please inform the SA team"
+	NotifyPodUnhealthy = "LAIN found pod unhealthy, ready to restart it"
+
+	NotifyRolloutFailed = "LAIN found upgrade from version %d to %d failed on instances %v, rolled back to version %d"
 )
 
 type notifyController struct {
@@ -131,19 +134,19 @@ func (nc *notifyController) CallbackList(callbackMap map[string]string) []string
 }
 
 func (nc *notifyController) Send(notifySpec NotifySpec) {
-	log.Infof("Receiving nofity request: %s", notifySpec)
+	log.Infof("Receiving nofity request: %+v", notifySpec)
 	nc.callbackChan <- notifySpec
 }
 
 func (nc *notifyController) Notify(notifySpec NotifySpec) {
 	nc.Lock()
 	defer nc.Unlock()
-	log.Infof("Ready sending notify request: %s", notifySpec)
+	log.Infof("Ready sending notify request: %+v", notifySpec)
 	callbackList := nc.CallbackList(nc.callbacks)
 	for i := 0; i < len(callbackList); i++ {
 		uri := callbackList[i]
 		if err := nc.Callback(uri, notifySpec); err != nil {
-			log.Errorf("Fail notify spec %s to %s: %s", notifySpec, uri, err)
+			log.Errorf("Fail notify spec %+v to %s: %s", notifySpec, uri, err)
 		}
 	}
 }
@@ -162,7 +165,7 @@ func (nc *notifyController) Callback(uri string, notifySpec NotifySpec) error {
 			return err
 		}
 		if resp.StatusCode >= 300 {
-			log.Infof("Error response from %s: status %s", resp.StatusCode)
+			log.Infof("Error response from %s: status %d", uri, resp.StatusCode)
 			var errMsg []byte
 			var cbErr error
 			defer resp.Body.Close()
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// the number of recent operations kept in memory
+var OperationHistoryLimit = 500
+
+var opsTracker *operationTracker
+
+const (
+	OperationStateQueued    = "queued"
+	OperationStateRunning   = "running"
+	OperationStateSucceeded = "succeeded"
+	OperationStateFailed    = "failed"
+)
+
+type InstanceResult struct {
+	InstanceNo int
+	State      RunState
+	LastError  string
+}
+
+// Operation is an accepted asynchronous request, e.g. a spec update of the pod group
+type Operation struct {
+	Id         string
+	Type       string
+	Target     string
+	State      string
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Instances  []InstanceResult
+	Error      string
+}
+
+func (op Operation) Clone() Operation {
+	n := op
+	n.Instances = make([]InstanceResult, len(op.Instances))
+	copy(n.Instances, op.Instances)
+	return n
+}
+
+type operationTracker struct {
+	sync.RWMutex
+	seq   int64
+	ops   map[string]*Operation
+	order []string
+	limit int
+}
+
+func NewOperationTracker(limit int) *operationTracker {
+	return &operationTracker{
+		ops:   make(map[string]*Operation),
+		order: make([]string, 0, limit),
+		limit: limit,
+	}
+}
+
+// New records a queued operation and returns the operation id
+func (ot *operationTracker) New(opType string, target string) string {
+	ot.Lock()
+	defer ot.Unlock()
+	ot.seq += 1
+	now := time.Now()
+	op := &Operation{
+		Id:       fmt.Sprintf("%d-%d", now.Unix(), ot.seq),
+		Type:     opType,
+		Target:   target,
+		State:    OperationStateQueued,
+		QueuedAt: now,
+	}
+	ot.ops[op.Id] = op
+	ot.order = append(ot.order, op.Id)
+	for ot.limit > 0 && len(ot.order) > ot.limit {
+		delete(ot.ops, ot.order[0])
+		ot.order = ot.order[1:]
+	}
+	return op.Id
+}
+
+func (ot *operationTracker) Start(id string) {
+	ot.Lock()
+	defer ot.Unlock()
+	if op, ok := ot.ops[id]; ok && op.State == OperationStateQueued {
+		op.State = OperationStateRunning
+		op.StartedAt = time.Now()
+	}
+}
+
+func (ot *operationTracker) Finish(id string, instances []InstanceResult, errMsg string) {
+	ot.Lock()
+	defer ot.Unlock()
+	if op, ok := ot.ops[id]; ok {
+		if op.StartedAt.IsZero() {
+			op.StartedAt = time.Now()
+		}
+		op.FinishedAt = time.Now()
+		op.Instances = instances
+		op.Error = errMsg
+		if errMsg == "" {
+			op.State = OperationStateSucceeded
+		} else {
+			op.State = OperationStateFailed
+		}
+	}
+}
+
+func (ot *operationTracker) Get(id string) (Operation, bool) {
+	ot.RLock()
+	defer ot.RUnlock()
+	if op, ok := ot.ops[id]; ok {
+		return op.Clone(), true
+	}
+	return Operation{}, false
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/sweb/log"
+)
+
+// orderedDeployment is shared by the ordered instance deployments of one operation,
+// the later instances are left alone once an instance fails to be ready.
+type orderedDeployment struct {
+	deployed  int
+	blockedOn int
+}
+
+// pgOperDeployOrderedInstance deploys the instance and waits for it to be ready before the next one starts
+type pgOperDeployOrderedInstance struct {
+	instanceNo int
+	version    int
+	deployment *orderedDeployment
+}
+
+func (op pgOperDeployOrderedInstance) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	if blockedOn := op.deployment.blockedOn; blockedOn > 0 {
+		pgCtrl.RLock()
+		log.Warnf("%s instance %d is not ready, leave instance %d undeployed", pgCtrl, blockedOn, op.instanceNo)
+		pgCtrl.RUnlock()
+		// mark it missing so the refresh will deploy it in order
+		podCtrl.pod.Containers = make([]Container, len(podCtrl.spec.Containers))
+		podCtrl.pod.State = RunStateMissing
+		podCtrl.pod.LastError = fmt.Sprintf("Waiting for instance %d to be ready", blockedOn)
+		return false
+	}
+	if op.deployment.deployed > 0 && podCtrl.spec.Readiness == nil {
+		// wait some seconds for the former instance's initialization completed
+		time.Sleep(time.Second * time.Duration(podCtrl.spec.GetSetupTime()))
+	}
+	pgOperDeployInstance{op.instanceNo, op.version}.Do(pgCtrl, c, store, ev)
+	op.deployment.deployed += 1
+	if podCtrl.pod.State != RunStateSuccess || !pgCtrl.waitInstanceReady(c, op.instanceNo, podCtrl) {
+		op.deployment.blockedOn = op.instanceNo
+	}
+	return false
+}
+
+// orderedBlocker returns the first instance before the given one which is not running, 0 if there is none
+func (pgCtrl *podGroupController) orderedBlocker(instanceNo int) int {
+	for i := 1; i < instanceNo && i <= len(pgCtrl.podCtrls); i += 1 {
+		if pgCtrl.podCtrls[i-1].pod.State != RunStateSuccess {
+			return i
+		}
+	}
+	return 0
+}
+
+// pgOperRecreateInstance deploys the lost instance again on the node it was running on,
+// the leftover containers should have been removed.
+type pgOperRecreateInstance struct {
+	instanceNo int
+	version    int
+}
+
+func (op pgOperRecreateInstance) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	newPodSpec := podCtrl.spec.Clone()
+	prevNodeName := newPodSpec.PrevState.NodeName
+	if prevNodeName != "" {
+		newPodSpec.Filters = append(newPodSpec.Filters, nodeFilter(prevNodeName, true))
+	}
+	pgCtrl.RLock()
+	log.Infof("%s recreate instance %d on node %q", pgCtrl, op.instanceNo, prevNodeName)
+	pgCtrl.RUnlock()
+	podCtrl.spec = newPodSpec
+	podCtrl.pod.State = RunStatePending
+	podCtrl.pod.RestartCount = 0
+	podCtrl.pod.NextRestartAt = time.Time{}
+	pgOperDeployInstance{op.instanceNo, op.version}.Do(pgCtrl, c, store, ev)
+	return false
+}
+
+func (pgCtrl *podGroupController) RecreateInstance(instanceNo int) {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if instanceNo < 1 || instanceNo > spec.NumInstances {
+		return
+	}
+	pgCtrl.opsChan <- pgOperLogOperation{fmt.Sprintf("Start to recreate instance %d", instanceNo)}
+	pgCtrl.opsChan <- pgOperRemoveInstance{instanceNo, spec.InstancePodSpec(instanceNo)}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	pgCtrl.opsChan <- pgOperRecreateInstance{instanceNo, spec.InstanceVersion(instanceNo)}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Recreate instance finished"}
+}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mijia/go-generics"
+)
+
+const (
+	PlanActionRecreate       = "recreate"        // remove the old instance and deploy the new one in place
+	PlanActionSurge          = "surge"           // deploy the new instance beside the old one, then remove the old one
+	PlanActionUpgrade        = "upgrade"         // upgrade the shared dependency pod on the node
+	PlanActionDependsAdd     = "depends.add"     // the dependency pod will be referenced on the node
+	PlanActionDependsRelease = "depends.release" // the dependency pod will be released on the node
+)
+
+// SpecChange is one field differs between the current spec and the new one
+type SpecChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+type PlanAction struct {
+	Action     string
+	Batch      int
+	InstanceNo int
+	Name       string
+	NodeName   string
+	Namespace  string
+	Filters    []string
+}
+
+// Plan is what the controller would do for the new spec, nothing is changed in the cluster
+type Plan struct {
+	Changed     bool
+	FromVersion int
+	ToVersion   int
+	Diff        []SpecChange
+	Actions     []PlanAction
+}
+
+// diffPodSpec lists the fields which are compared in PodSpec.Equals
+func diffPodSpec(old, new PodSpec) []SpecChange {
+	var changes []SpecChange
+	if len(old.Containers) != len(new.Containers) {
+		changes = append(changes, SpecChange{"Containers", old.Containers, new.Containers})
+	} else {
+		for i := range old.Containers {
+			if !old.Containers[i].Equals(new.Containers[i]) {
+				changes = append(changes, SpecChange{fmt.Sprintf("Containers[%d]", i), old.Containers[i], new.Containers[i]})
+			}
+		}
+	}
+	if len(old.InitContainers) != len(new.InitContainers) {
+		changes = append(changes, SpecChange{"InitContainers", old.InitContainers, new.InitContainers})
+	} else {
+		for i := range old.InitContainers {
+			if !old.InitContainers[i].Equals(new.InitContainers[i]) {
+				changes = append(changes, SpecChange{fmt.Sprintf("InitContainers[%d]", i), old.InitContainers[i], new.InitContainers[i]})
+			}
+		}
+	}
+	if old.InitTimeout != new.InitTimeout {
+		changes = append(changes, SpecChange{"InitTimeout", old.InitTimeout, new.InitTimeout})
+	}
+	sameDeps := len(old.Dependencies) == len(new.Dependencies)
+	for i := 0; sameDeps && i < len(old.Dependencies); i += 1 {
+		sameDeps = old.Dependencies[i] == new.Dependencies[i]
+	}
+	if !sameDeps {
+		changes = append(changes, SpecChange{"Dependencies", old.Dependencies, new.Dependencies})
+	}
+	if old.Annotation != new.Annotation {
+		changes = append(changes, SpecChange{"Annotation", old.Annotation, new.Annotation})
+	}
+	if old.Stateful != new.Stateful {
+		changes = append(changes, SpecChange{"Stateful", old.Stateful, new.Stateful})
+	}
+	if !generics.Equal_StringSlice(old.Filters, new.Filters) {
+		changes = append(changes, SpecChange{"Filters", old.Filters, new.Filters})
+	}
+	if !old.Affinity.Equals(new.Affinity) {
+		changes = append(changes, SpecChange{"Affinity", old.Affinity, new.Affinity})
+	}
+	if old.ReadinessDeadline != new.ReadinessDeadline {
+		changes = append(changes, SpecChange{"ReadinessDeadline", old.ReadinessDeadline, new.ReadinessDeadline})
+	}
+	if !((old.Readiness == nil && new.Readiness == nil) ||
+		(old.Readiness != nil && new.Readiness != nil && old.Readiness.Equals(*new.Readiness))) {
+		changes = append(changes, SpecChange{"Readiness", old.Readiness, new.Readiness})
+	}
+	return changes
+}
+
+// PlanSpec runs the decisions of RescheduleSpec against the current state without touching the cluster
+func (pgCtrl *podGroupController) PlanSpec(podSpec PodSpec, strategy ...RollingUpdateStrategy) Plan {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	podCtrls := make([]podController, len(pgCtrl.podCtrls))
+	for i, podCtrl := range pgCtrl.podCtrls {
+		podCtrls[i] = podController{spec: podCtrl.spec.Clone(), pod: podCtrl.pod.Clone()}
+	}
+	pgCtrl.RUnlock()
+
+	plan := Plan{FromVersion: spec.Version, ToVersion: spec.Version}
+	if len(strategy) > 0 {
+		spec.RollingUpdate = strategy[0]
+	}
+	if spec.Pod.Equals(podSpec) {
+		return plan
+	}
+
+	oldPodSpec := spec.Pod.Clone()
+	newPodSpec := spec.Pod.Merge(podSpec)
+	plan.Changed = true
+	plan.ToVersion = spec.Version + 1
+	plan.Diff = diffPodSpec(oldPodSpec, newPodSpec)
+
+	// the same batches as rollingUpgrade
+	surge, unavailable := spec.RolloutBatch(len(podCtrls), oldPodSpec, newPodSpec)
+	batchSize := surge + unavailable
+	added := make(map[DependencyEvent]bool)
+	for i := range podCtrls {
+		podCtrl := &podCtrls[i]
+		instanceNo := podCtrl.pod.InstanceNo
+		nodeName := podCtrl.pod.NodeName()
+		if nodeName == "" {
+			nodeName = podCtrl.spec.PrevState.NodeName
+		}
+		action := PlanAction{
+			Batch:      i/batchSize + 1,
+			InstanceNo: instanceNo,
+			Name:       spec.Name,
+			NodeName:   nodeName,
+			Namespace:  spec.Namespace,
+		}
+		if i%batchSize < surge {
+			action.Action = PlanActionSurge
+			action.Filters = newPodSpec.Filters
+		} else {
+			action.Action = PlanActionRecreate
+			action.Filters = upgradePodSpec(podCtrl, oldPodSpec, newPodSpec).Filters
+		}
+		plan.Actions = append(plan.Actions, action)
+
+		// the dependency events of the old and new pods which cannot cancel each other out
+		if nodeName == "" {
+			continue
+		}
+		oldEvents := make(map[DependencyEvent]bool)
+		for _, evt := range dependencyEvents("", oldPodSpec, nodeName) {
+			oldEvents[evt] = true
+		}
+		newEvents := make(map[DependencyEvent]bool)
+		for _, evt := range dependencyEvents("", newPodSpec, nodeName) {
+			newEvents[evt] = true
+			if !oldEvents[evt] && !added[evt] {
+				added[evt] = true
+				plan.Actions = append(plan.Actions, PlanAction{
+					Action:     PlanActionDependsAdd,
+					Batch:      action.Batch,
+					InstanceNo: instanceNo,
+					Name:       evt.Name,
+					NodeName:   evt.NodeName,
+					Namespace:  evt.Namespace,
+				})
+			}
+		}
+		for _, evt := range dependencyEvents("", oldPodSpec, nodeName) {
+			if !newEvents[evt] {
+				plan.Actions = append(plan.Actions, PlanAction{
+					Action:     PlanActionDependsRelease,
+					Batch:      action.Batch,
+					InstanceNo: instanceNo,
+					Name:       evt.Name,
+					NodeName:   evt.NodeName,
+					Namespace:  evt.Namespace,
+				})
+			}
+		}
+	}
+	return plan
+}
+
+// PlanSpec lists the shared pods which would be upgraded for the new spec
+func (depCtrl *dependsController) PlanSpec(newSpec PodSpec) Plan {
+	depCtrl.RLock()
+	defer depCtrl.RUnlock()
+
+	plan := Plan{FromVersion: depCtrl.spec.Version, ToVersion: depCtrl.spec.Version}
+	if depCtrl.spec.Equals(newSpec) {
+		return plan
+	}
+	mergeSpec := depCtrl.spec.Merge(newSpec)
+	plan.Changed = true
+	plan.ToVersion = mergeSpec.Version
+	plan.Diff = diffPodSpec(depCtrl.spec, mergeSpec)
+
+	for node, nsPodCtrls := range depCtrl.podCtrls {
+		for namespace := range nsPodCtrls {
+			plan.Actions = append(plan.Actions, PlanAction{
+				Action:    PlanActionUpgrade,
+				Name:      depCtrl.spec.Name,
+				NodeName:  node,
+				Namespace: namespace,
+				Filters:   depCtrl.specifyPodSpec(mergeSpec, node, namespace).Filters,
+			})
+		}
+	}
+	sort.Sort(planActionsByNode(plan.Actions))
+	return plan
+}
+
+type planActionsByNode []PlanAction
+
+func (a planActionsByNode) Len() int      { return len(a) }
+func (a planActionsByNode) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a planActionsByNode) Less(i, j int) bool {
+	if a[i].NodeName != a[j].NodeName {
+		return a[i].NodeName < a[j].NodeName
+	}
+	return a[i].Namespace < a[j].Namespace
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestDiffPodSpec(t *testing.T) {
+	base := PodSpec{
+		Containers: []ContainerSpec{{Image: "hello/web:v1"}, {Image: "hello/agent:v1"}},
+		Filters:    []string{"constraint:node==node1"},
+	}
+	base.Name = "hello.web.web"
+	with := func(change func(spec *PodSpec)) PodSpec {
+		spec := base.Clone()
+		change(&spec)
+		return spec
+	}
+	tests := []struct {
+		new    PodSpec
+		fields []string
+	}{
+		{base.Clone(), nil},
+		{with(func(spec *PodSpec) { spec.Containers[1].Image = "hello/agent:v2" }), []string{"Containers[1]"}},
+		{with(func(spec *PodSpec) { spec.Containers = spec.Containers[:1] }), []string{"Containers"}},
+		{with(func(spec *PodSpec) { spec.InitContainers = []ContainerSpec{{Image: "hello/init:v1"}} }), []string{"InitContainers"}},
+		{with(func(spec *PodSpec) {
+			spec.Containers[0].Image = "hello/web:v2"
+			spec.Annotation = "new"
+			spec.Stateful = true
+		}), []string{"Containers[0]", "Annotation", "Stateful"}},
+		{with(func(spec *PodSpec) { spec.Filters = nil }), []string{"Filters"}},
+		{with(func(spec *PodSpec) { spec.Dependencies = []Dependency{{PodName: "hello.portal"}} }), []string{"Dependencies"}},
+		{with(func(spec *PodSpec) { spec.ReadinessDeadline = 60 }), []string{"ReadinessDeadline"}},
+		{with(func(spec *PodSpec) { spec.Readiness = &ProbeSpec{InitialDelay: 5} }), []string{"Readiness"}},
+	}
+	for i, test := range tests {
+		changes := diffPodSpec(base, test.new)
+		if len(changes) != len(test.fields) {
+			t.Errorf("Case %d should change %v, got %+v", i, test.fields, changes)
+			continue
+		}
+		for j, field := range test.fields {
+			if changes[j].Field != field {
+				t.Errorf("Case %d should change %v, got %+v", i, test.fields, changes)
+				break
+			}
+		}
+		if (len(changes) == 0) != base.Equals(test.new) {
+			t.Errorf("Case %d should agree with PodSpec.Equals, got %+v", i, changes)
+		}
+	}
+}
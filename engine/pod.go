@@ -19,15 +19,21 @@ var RestartInfoClearInterval time.Duration
 
 // podController is controlled by the podGroupController
 type podController struct {
-	spec PodSpec
-	pod  Pod
+	spec     PodSpec
+	pod      Pod
+	spread   TopologySpreadSpec // the topology spread of the pod group
+	node     string             // the node which the daemon instance is pinned to
+	vacant   bool               // the daemon instance has no node, it is never deployed
+	hostname string             // the stable hostname of the ordered instance
 }
 
 func (pc *podController) String() string {
 	return fmt.Sprintf("PodCtrl %s", pc.spec)
 }
 
-func (pc *podController) Deploy(cluster cluster.Cluster) {
+// Deploy creates and starts the containers of the pending pod, the placements are the number of the other
+// instances of the pod group on each node, which are used by the native scheduler
+func (pc *podController) Deploy(cluster cluster.Cluster, placements map[string]int) {
 	if pc.pod.State != RunStatePending {
 		return
 	}
@@ -48,12 +54,50 @@ func (pc *podController) Deploy(cluster cluster.Cluster) {
 		Name: pc.spec.Name,
 	}
 	filters = append(filters, containerLabel.NameAffinity())
+	filters = append(filters, pc.spec.Affinity.Filters()...)
 
 	constraints := cstController.GetAllConstraints()
 	for _, cstSpec := range constraints {
 		filter := cstController.LoadFilterFromConstrain(cstSpec)
 		filters = append(filters, filter)
 	}
+	if pc.node != "" {
+		filters = append(filters, nodeFilter(pc.node, true))
+	}
+
+	if nodeName, err := pc.scheduleNode(cluster, filters, placements); err != nil {
+		log.Warnf("%s Cannot schedule the instance, %s", pc, err)
+		pc.pod.State = RunStateFail
+		pc.pod.LastError = err.Error()
+		return
+	} else if nodeName != "" {
+		filters = append(filters, nodeFilter(nodeName, true))
+	}
+
+	if nodeName, err := pc.renderConfigs(cluster, filters); err != nil {
+		log.Warnf("%s %s", pc, err)
+		pc.pod.State = RunStateFail
+		pc.pod.LastError = err.Error()
+		return
+	} else if nodeName != "" {
+		// the containers should be on the node with the rendered configs
+		filters = append(filters, nodeFilter(nodeName, true))
+	}
+
+	pc.pod.InitContainers = nil
+	if len(pc.spec.InitContainers) > 0 {
+		nodeName, err := pc.runInitContainers(cluster, filters)
+		if err != nil {
+			log.Warnf("%s Init containers failed, %s", pc, err)
+			pc.pod.State = RunStateFail
+			pc.pod.LastError = err.Error()
+			return
+		}
+		if nodeName != "" {
+			// the containers should be on the same node with the init containers
+			filters = append(filters, nodeFilter(nodeName, true))
+		}
+	}
 
 	for i, cSpec := range pc.spec.Containers {
 		log.Infof("%s create container, filter is %v", pc, filters)
@@ -74,7 +118,7 @@ func (pc *podController) Deploy(cluster cluster.Cluster) {
 		pc.refreshContainer(cluster, i)
 
 		if i == 0 && pc.pod.Containers[0].NodeName != "" {
-			filter := fmt.Sprintf("constraint:node==%s", pc.pod.Containers[0].NodeName)
+			filter := nodeFilter(pc.pod.Containers[0].NodeName, true)
 			filters = append(filters, filter)
 			pc.spec.PrevState.NodeName = pc.pod.Containers[i].NodeName
 		}
@@ -85,7 +129,70 @@ func (pc *podController) Deploy(cluster cluster.Cluster) {
 	}
 }
 
-func (pc *podController) Drift(cluster cluster.Cluster, fromNode, toNode string, force bool) bool {
+// runInitContainers runs the init containers one by one, each one should exit 0 before the next one starts.
+// Returns the node which the init containers run on.
+func (pc *podController) runInitContainers(cluster cluster.Cluster, filters []string) (string, error) {
+	pc.pod.InitContainers = make([]Container, len(pc.spec.InitContainers))
+	nodeName := ""
+	for i := range pc.spec.InitContainers {
+		index := -i - 1
+		// the failed init container of last deploy may still be there
+		if info, err := cluster.InspectContainer(pc.createContainerName(index)); err == nil {
+			cluster.RemoveContainer(info.Id, true, false)
+		}
+
+		log.Infof("%s create init container %d, filter is %v", pc, i, filters)
+		id, err := pc.createContainer(cluster, filters, index)
+		if err != nil {
+			return nodeName, fmt.Errorf("Cannot create init container %d, %s", i, err)
+		}
+		pc.pod.InitContainers[i].Id = id
+		if err := cluster.StartContainer(id); err != nil {
+			return nodeName, fmt.Errorf("Cannot start init container %d, %s", i, err)
+		}
+		info, err := pc.waitInitContainer(cluster, id)
+		if err != nil {
+			return nodeName, fmt.Errorf("Init container %d failed, %s", i, err)
+		}
+		redactSecretEnvs(&info, pc.spec.InitContainers[i])
+		pc.pod.InitContainers[i] = Container{
+			Id:       id,
+			Runtime:  info,
+			NodeName: info.Node.Name,
+			NodeIp:   info.Node.IP,
+		}
+		if info.State.ExitCode != 0 {
+			return nodeName, fmt.Errorf("Init container %d exited with %d, %s", i, info.State.ExitCode, info.State.Error)
+		}
+		if nodeName == "" && info.Node.Name != "" {
+			nodeName = info.Node.Name
+			filters = append(filters, nodeFilter(nodeName, true))
+			pc.spec.PrevState.NodeName = nodeName
+		}
+	}
+	return nodeName, nil
+}
+
+func (pc *podController) waitInitContainer(cluster cluster.Cluster, id string) (adoc.ContainerDetail, error) {
+	timeout := pc.spec.GetInitTimeout()
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := cluster.InspectContainer(id)
+		if err != nil {
+			return info, err
+		}
+		if !info.State.Running {
+			return info, nil
+		}
+		if time.Now().After(deadline) {
+			cluster.StopContainer(id, pc.spec.GetKillTimeout())
+			return info, fmt.Errorf("not exited in %s", timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (pc *podController) Drift(cluster cluster.Cluster, fromNode, toNode string, force bool, placements map[string]int) bool {
 	if pc.pod.State == RunStatePending {
 		return false
 	}
@@ -117,11 +224,11 @@ func (pc *podController) Drift(cluster cluster.Cluster, fromNode, toNode string,
 	pc.pod.State = RunStatePending
 	pc.pod.DriftCount += 1
 	if toNode == "" {
-		pc.spec.Filters = append(pc.spec.Filters, fmt.Sprintf("constraint:node!=%s", fromNode))
+		pc.spec.Filters = append(pc.spec.Filters, nodeFilter(fromNode, false))
 	} else {
-		pc.spec.Filters = append(pc.spec.Filters, fmt.Sprintf("constraint:node==%s", toNode))
+		pc.spec.Filters = append(pc.spec.Filters, nodeFilter(toNode, true))
 	}
-	pc.Deploy(cluster)
+	pc.Deploy(cluster, placements)
 	return true
 }
 
@@ -133,6 +240,15 @@ func (pc *podController) Remove(cluster cluster.Cluster) {
 	}()
 
 	pc.pod.LastError = ""
+	for _, container := range pc.pod.InitContainers {
+		if container.Id == "" {
+			continue
+		}
+		if err := cluster.RemoveContainer(container.Id, true, false); err != nil && !adoc.IsNotFound(err) {
+			log.Warnf("%s Cannot remove the init container %s, %s", pc, container.Id, err)
+		}
+	}
+	pc.pod.InitContainers = nil
 	for _, container := range pc.pod.Containers {
 		if container.Id == "" {
 			continue
@@ -151,8 +267,9 @@ func (pc *podController) Remove(cluster cluster.Cluster) {
 	pc.pod.UpdatedAt = time.Now()
 }
 
+// Stop stops the containers in place, the container runtime and prev state are kept for starting them again
 func (pc *podController) Stop(cluster cluster.Cluster) {
-	if pc.pod.State != RunStateSuccess {
+	if pc.pod.State == RunStatePending || pc.pod.State == RunStateStopped {
 		return
 	}
 	log.Infof("%s stopping", pc)
@@ -161,15 +278,17 @@ func (pc *podController) Stop(cluster cluster.Cluster) {
 		log.Infof("%s stopped, state=%+v, duration=%s", pc, pc.pod.ImRuntime, time.Now().Sub(start))
 	}()
 
+	pc.pod.State = RunStateStopped
 	pc.pod.LastError = ""
 
-	for i, container := range pc.pod.Containers {
+	for _, container := range pc.pod.Containers {
+		if container.Id == "" {
+			continue
+		}
 		if err := cluster.StopContainer(container.Id, pc.spec.GetKillTimeout()); err != nil {
 			log.Warnf("%s Cannot stop the container %s, %s", pc, container.Id, err)
 			pc.pod.State = RunStateFail
 			pc.pod.LastError = fmt.Sprintf("Cannot stop container, %s", err)
-		} else {
-			pc.refreshContainer(cluster, i)
 		}
 	}
 	pc.pod.UpdatedAt = time.Now()
@@ -184,6 +303,14 @@ func (pc *podController) Start(cluster cluster.Cluster) {
 	defer func() {
 		log.Infof("%s started, state=%+v, duration=%s", pc, pc.pod.ImRuntime, time.Now().Sub(start))
 	}()
+	if pc.pod.State == RunStateUnhealthy {
+		// unhealthy containers are still running, stop them before starting again
+		for _, container := range pc.pod.Containers {
+			if err := cluster.StopContainer(container.Id, pc.spec.GetKillTimeout()); err != nil {
+				log.Warnf("%s Cannot stop the unhealthy container %s, %s", pc, container.Id, err)
+			}
+		}
+	}
 	pc.pod.State = RunStateSuccess
 	pc.pod.LastError = ""
 	for i, container := range pc.pod.Containers {
@@ -236,7 +363,7 @@ func (pc *podController) tryCorrectIPAddress(c cluster.Cluster, id, fromIP, toIP
 		log.Infof("%s try to recover network using old ip %s", pc, fromIP)
 		if err := c.ConnectContainer(pc.spec.Namespace, id, fromIP); err != nil {
 			log.Errorf("%s fail to recover network %s to container %s by using oldIP %s, %s, now container ip lost, give up!", pc, pc.spec.Namespace, id, fromIP, err.Error())
-			log.Warnf("%s can not set any ip for container %s, give ip!!!")
+			log.Warnf("%s can not set any ip for container %s, give ip!!!", pc, id)
 		}
 		return false
 	}
@@ -266,6 +393,7 @@ func (pc *podController) refreshContainer(kluster cluster.Cluster, index int) {
 			pc.pod.LastError = fmt.Sprintf("Cannot inspect the container, %s", err)
 		}
 	} else {
+		redactSecretEnvs(&info, spec)
 		network := pc.spec.Network
 		if network == "" {
 			network = pc.spec.Namespace
@@ -282,26 +410,42 @@ func (pc *podController) refreshContainer(kluster cluster.Cluster, index int) {
 			}
 		}
 
+		health := pc.pod.Containers[index].Health
 		container := Container{
-			Id:            id,
-			Runtime:       info,
-			NodeName:      info.Node.Name,
-			NodeIp:        info.Node.IP,
-			Protocol:      "tcp",
-			ContainerIp:   nowIP,
-			ContainerPort: spec.Expose,
-		}
-		// FIXME: until we start working on the multiple ports
-		if ports, ok := info.NetworkSettings.Ports[fmt.Sprintf("%d/tcp", spec.Expose)]; ok && len(ports) > 0 {
-			if port, err := strconv.Atoi(ports[0].HostPort); err == nil {
-				container.NodePort = port
+			Id:          id,
+			Runtime:     info,
+			NodeName:    info.Node.Name,
+			NodeIp:      info.Node.IP,
+			Protocol:    PortProtocolTCP,
+			ContainerIp: nowIP,
+			Health:      health,
+		}
+		for _, portSpec := range spec.GetPorts() {
+			binding := ContainerPortBinding{
+				ContainerPort: portSpec.ContainerPort,
+				Protocol:      portSpec.GetProtocol(),
+			}
+			if ports, ok := info.NetworkSettings.Ports[portSpec.DockerPort()]; ok && len(ports) > 0 {
+				if port, err := strconv.Atoi(ports[0].HostPort); err == nil {
+					binding.NodePort = port
+				}
 			}
+			container.Ports = append(container.Ports, binding)
+		}
+		if len(container.Ports) > 0 {
+			container.ContainerPort = container.Ports[0].ContainerPort
+			container.NodePort = container.Ports[0].NodePort
+			container.Protocol = container.Ports[0].Protocol
+		}
+
+		state := info.State
+		if state.Running && spec.HealthCheck != nil {
+			pc.refreshHealth(kluster, &container, *spec.HealthCheck, state.StartedAt)
 		}
 
 		pc.spec.PrevState.NodeName = info.Node.Name
 		pc.spec.PrevState.IPs[index] = container.ContainerIp
 		pc.pod.Containers[index] = container
-		state := info.State
 		if !state.Running {
 			if state.ExitCode == 0 {
 				pc.pod.State = RunStateExit
@@ -309,12 +453,18 @@ func (pc *podController) refreshContainer(kluster cluster.Cluster, index int) {
 				pc.pod.State = RunStateFail
 				pc.pod.LastError = state.Error
 			}
+		} else if container.Health.Unhealthy && pc.pod.State == RunStateSuccess {
+			pc.pod.State = RunStateUnhealthy
+			pc.pod.LastError = fmt.Sprintf("Container %q health check failed, %s", id, container.Health.LastError)
 		}
 	}
 }
 
 func (pc *podController) createContainer(cluster cluster.Cluster, filters []string, index int) (string, error) {
-	cc := pc.createContainerConfig(filters, index)
+	cc, err := pc.createContainerConfig(filters, index)
+	if err != nil {
+		return "", err
+	}
 	hc := pc.createHostConfig(index)
 	nc := pc.createNetworkingConfig(index)
 	name := pc.createContainerName(index)
@@ -328,12 +478,46 @@ func (pc *podController) createContainer(cluster cluster.Cluster, filters []stri
 	//log.Warnf("%s Failed to rename the container as we need it, %s", pc, err)
 	//}
 	//}
-	return cluster.CreateContainer(cc, hc, nc, name)
+	id, err := cluster.CreateContainer(cc, hc, nc, name)
+	if err != nil {
+		return "", err
+	}
+	if err := pc.copySecretFiles(cluster, id, index); err != nil {
+		if rmErr := cluster.RemoveContainer(id, true, false); rmErr != nil {
+			log.Warnf("%s Cannot remove the container %s without the secret files, %s", pc, id, rmErr)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// copySecretFiles puts the secret files into the created container, they are never written onto the node by deployd
+func (pc *podController) copySecretFiles(cluster cluster.Cluster, id string, index int) error {
+	spec := pc.containerSpec(index)
+	if len(spec.SecretFiles) == 0 {
+		return nil
+	}
+	archive, err := secretFilesArchive(pc.spec.Namespace, spec)
+	if err != nil {
+		return err
+	}
+	if err := cluster.CopyToContainer(id, "/", archive); err != nil {
+		return fmt.Errorf("Cannot copy the secret files, %s", err)
+	}
+	return nil
 }
 
-func (pc *podController) createContainerConfig(filters []string, index int) adoc.ContainerConfig {
+// containerSpec returns the spec of the container, the init containers have the negative indexes from -1
+func (pc *podController) containerSpec(index int) ContainerSpec {
+	if index < 0 {
+		return pc.spec.InitContainers[-index-1]
+	}
+	return pc.spec.Containers[index]
+}
+
+func (pc *podController) createContainerConfig(filters []string, index int) (adoc.ContainerConfig, error) {
 	podSpec := pc.spec
-	spec := podSpec.Containers[index]
+	spec := pc.containerSpec(index)
 
 	volumes := make(map[string]struct{})
 	for _, v := range spec.Volumes {
@@ -352,6 +536,11 @@ func (pc *podController) createContainerConfig(filters []string, index int) adoc
 		fmt.Sprintf("DEPLOYD_POD_NAMESPACE=%s", pc.spec.Namespace),
 	}...)
 	injectEnvs = append(injectEnvs, filters...)
+	if envs, err := secretEnvs(podSpec.Namespace, spec); err != nil {
+		return adoc.ContainerConfig{}, err
+	} else {
+		injectEnvs = append(injectEnvs, envs...)
+	}
 
 	containerLabel := ContainerLabel{
 		Name:           podSpec.Name,
@@ -375,24 +564,34 @@ func (pc *podController) createContainerConfig(filters []string, index int) adoc
 		Volumes:    volumes,
 		Entrypoint: spec.Entrypoint,
 		Labels:     containerLabel.Label2Maps(),
+		Hostname:   pc.hostname,
 	}
-	if spec.Expose > 0 {
-		cc.ExposedPorts = map[string]struct{}{
-			fmt.Sprintf("%d/tcp", spec.Expose): struct{}{},
+	if ports := spec.GetPorts(); len(ports) > 0 {
+		cc.ExposedPorts = make(map[string]struct{})
+		for _, port := range ports {
+			cc.ExposedPorts[port.DockerPort()] = struct{}{}
 		}
 	}
-	return cc
+	return cc, nil
 }
 
 func (pc *podController) createHostConfig(index int) adoc.HostConfig {
 	podSpec := pc.spec
-	spec := podSpec.Containers[index]
+	spec := pc.containerSpec(index)
+	volumeIndex := index
+	if volumeIndex < 0 {
+		// init containers share the volumes of the first container
+		volumeIndex = 0
+	}
 	hc := adoc.HostConfig{}
-	if spec.Expose > 0 {
-		hc.PortBindings = map[string][]adoc.PortBinding{
-			fmt.Sprintf("%d/tcp", spec.Expose): []adoc.PortBinding{
-				adoc.PortBinding{},
-			},
+	if ports := spec.GetPorts(); len(ports) > 0 {
+		hc.PortBindings = make(map[string][]adoc.PortBinding)
+		for _, port := range ports {
+			binding := adoc.PortBinding{}
+			if port.HostPort > 0 {
+				binding.HostPort = strconv.Itoa(port.HostPort)
+			}
+			hc.PortBindings[port.DockerPort()] = []adoc.PortBinding{binding}
 		}
 	}
 	if len(spec.Volumes) > 0 {
@@ -400,7 +599,7 @@ func (pc *podController) createHostConfig(index int) adoc.HostConfig {
 		for i, v := range spec.Volumes {
 			// /data/lain/volumes/hello/hello.proc.web.foo/1/{c0}/{v:v}
 			if len(podSpec.Containers) > 1 {
-				binds[i] = fmt.Sprintf("%s/%s/%s/%d/c%d/%s:%s", kLainVolumeRoot, podSpec.Namespace, podSpec.Name, pc.pod.InstanceNo, index, v, v)
+				binds[i] = fmt.Sprintf("%s/%s/%s/%d/c%d/%s:%s", kLainVolumeRoot, podSpec.Namespace, podSpec.Name, pc.pod.InstanceNo, volumeIndex, v, v)
 			} else {
 				binds[i] = fmt.Sprintf("%s/%s/%s/%d/%s:%s", kLainVolumeRoot, podSpec.Namespace, podSpec.Name, pc.pod.InstanceNo, v, v)
 			}
@@ -408,6 +607,7 @@ func (pc *podController) createHostConfig(index int) adoc.HostConfig {
 		hc.Binds = binds
 	}
 	hc.Binds = append(hc.Binds, spec.SystemVolumes...)
+	hc.Binds = append(hc.Binds, configBinds(podSpec.Namespace, spec)...)
 
 	if len(spec.CloudVolumes) > 0 {
 		var binds []string
@@ -442,7 +642,9 @@ func (pc *podController) createHostConfig(index int) adoc.HostConfig {
 func (pc *podController) createContainerName(index int) string {
 	segs := make([]string, 0, 2)
 	segs = append(segs, fmt.Sprintf("%s.v%d-i%d-d%d", pc.spec.Name, pc.spec.Version, pc.pod.InstanceNo, pc.pod.DriftCount))
-	if len(pc.spec.Containers) > 1 {
+	if index < 0 {
+		segs = append(segs, fmt.Sprintf("init%d", -index-1))
+	} else if len(pc.spec.Containers) > 1 {
 		segs = append(segs, fmt.Sprintf("c%d", index))
 	}
 	return strings.Join(segs, "-")
@@ -456,7 +658,9 @@ func (pc *podController) createNetworkingConfig(index int) adoc.NetworkingConfig
 	}
 	nc := adoc.NetworkingConfig{}
 	ipamc := adoc.IPAMConfig{}
-	ipamc.IPv4Address = pc.spec.PrevState.IPs[index]
+	if index >= 0 {
+		ipamc.IPv4Address = pc.spec.PrevState.IPs[index]
+	}
 	nc.EndpointsConfig = map[string]adoc.EndpointConfig{
 		net: adoc.EndpointConfig{
 			ipamc,
@@ -1,5 +1,10 @@
+//go:build integration
+// +build integration
+
 package engine
 
+// the tests need the etcd and the swarm cluster below, run them by go test -tags integration
+
 import (
 	"testing"
 	"time"
@@ -15,12 +20,12 @@ func TestPodController(t *testing.T) {
 	isDebug := true
 
 	log.EnableDebug()
-	store, err := etcd.NewStore(etcdAddr, isDebug)
+	_, err := etcd.NewStore(etcdAddr, isDebug)
 	if err != nil {
 		t.Errorf("Cannot init the etcd storage")
 	}
 
-	c, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, nm, isDebug)
+	c, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, isDebug)
 	if err != nil {
 		t.Errorf("Cannot init the swarm cluster manager")
 	}
@@ -41,7 +46,7 @@ func TestPodController(t *testing.T) {
 	}
 	pc.pod.State = RunStatePending
 
-	pc.Deploy(c)
+	pc.Deploy(c, nil)
 	if pc.pod.State != RunStateSuccess {
 		t.Errorf("Pod should be deployed")
 	}
@@ -15,6 +15,7 @@ type PodGroupWithSpec struct {
 	Spec      PodGroupSpec
 	PrevState []PodPrevState
 	PodGroup
+	Topology *TopologySkew // only reported by the inspection when the topology spread is enabled
 }
 
 type podGroupController struct {
@@ -29,8 +30,15 @@ type podGroupController struct {
 	podCtrls   []*podController
 	opsChan    chan pgOperation
 
+	rolloutPrevSpec PodGroupSpec // the spec before the running rollout, used to roll back
+
+	runningOperation   string // the id of the tracked operation being executed
+	operationStartedAt time.Time
+	operationTouched   map[int]bool // the instances the running operation has acted on
+
 	storedKey    string
 	storedKeyDir string
+	revisionsKey string
 }
 
 func (pgCtrl *podGroupController) String() string {
@@ -40,13 +48,26 @@ func (pgCtrl *podGroupController) String() string {
 func (pgCtrl *podGroupController) Inspect() PodGroupWithSpec {
 	pgCtrl.RLock()
 	defer pgCtrl.RUnlock()
-	return PodGroupWithSpec{pgCtrl.spec, pgCtrl.prevState, pgCtrl.group}
+	group := pgCtrl.group
+	if group.Rollout != nil {
+		// the rollout is changed in place by the pod group operations
+		rollout := group.Rollout.Clone()
+		group.Rollout = &rollout
+	}
+	return PodGroupWithSpec{Spec: pgCtrl.spec, PrevState: pgCtrl.prevState, PodGroup: group}
 }
 
 func (pgCtrl *podGroupController) IsHealthy() bool {
 	pgCtrl.RLock()
 	defer pgCtrl.RUnlock()
+	if pgCtrl.spec.IsJob() {
+		// the pending and exited job instances have no ip
+		return true
+	}
 	for _, pc := range pgCtrl.podCtrls {
+		if pc.vacant {
+			continue
+		}
 		if pc.pod.PodIp() == "" {
 			ntfController.Send(NewNotifySpec(pc.spec.Namespace, pc.spec.Name, pc.pod.InstanceNo, NotifyPodIPLost))
 			return false
@@ -61,6 +82,24 @@ func (pgCtrl *podGroupController) IsRemoved() bool {
 	return pgCtrl.group.State == RunStateRemoved
 }
 
+func (pgCtrl *podGroupController) HasCanary() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	return pgCtrl.spec.Canary != nil
+}
+
+func (pgCtrl *podGroupController) IsStopped() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	return pgCtrl.spec.Stopped
+}
+
+func (pgCtrl *podGroupController) IsJob() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	return pgCtrl.spec.IsJob()
+}
+
 func (pgCtrl *podGroupController) IsPending() bool {
 	pgCtrl.RLock()
 	defer pgCtrl.RUnlock()
@@ -72,11 +111,25 @@ func (pgCtrl *podGroupController) Deploy() {
 	spec := pgCtrl.spec.Clone()
 	pgCtrl.RUnlock()
 
+	if spec.IsCron() {
+		pgCtrl.deployCron(spec)
+		return
+	}
+	if spec.IsJob() {
+		pgCtrl.deployJob(spec)
+		return
+	}
 	pgCtrl.opsChan <- pgOperLogOperation{"Start to deploy"}
 	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSaveRevision{spec.Version, spec.Pod}
 	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	deployment := &orderedDeployment{}
 	for i := 0; i < spec.NumInstances; i += 1 {
-		pgCtrl.opsChan <- pgOperDeployInstance{i + 1, spec.Version}
+		if spec.Ordered {
+			pgCtrl.opsChan <- pgOperDeployOrderedInstance{i + 1, spec.Version, deployment}
+		} else {
+			pgCtrl.opsChan <- pgOperDeployInstance{i + 1, spec.Version}
+		}
 	}
 	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
 	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
@@ -112,12 +165,18 @@ func (pgCtrl *podGroupController) RescheduleInstance(numInstances int, restartPo
 	if delta != 0 {
 		pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
 		if delta > 0 {
+			deployment := &orderedDeployment{}
 			for i := 0; i < delta; i += 1 {
 				instanceNo := i + 1 + curNumInstances
 				pgCtrl.opsChan <- pgOperPushPodCtrl{spec.Pod}
-				pgCtrl.opsChan <- pgOperDeployInstance{instanceNo, spec.Version}
+				if spec.Ordered {
+					pgCtrl.opsChan <- pgOperDeployOrderedInstance{instanceNo, spec.Version, deployment}
+				} else {
+					pgCtrl.opsChan <- pgOperDeployInstance{instanceNo, spec.Version}
+				}
 			}
 		} else {
+			// the instances are always removed in the reverse order
 			delta *= -1
 			for i := 0; i < delta; i += 1 {
 				pgCtrl.opsChan <- pgOperRemoveInstance{curNumInstances - i, spec.Pod}
@@ -131,15 +190,23 @@ func (pgCtrl *podGroupController) RescheduleInstance(numInstances int, restartPo
 	pgCtrl.opsChan <- pgOperLogOperation{"Reschedule instance number finished"}
 }
 
-func (pgCtrl *podGroupController) RescheduleSpec(podSpec PodSpec) {
+func (pgCtrl *podGroupController) RescheduleSpec(podSpec PodSpec, strategy ...RollingUpdateStrategy) {
 	pgCtrl.RLock()
 	spec := pgCtrl.spec.Clone()
 	pgCtrl.RUnlock()
 
+	if len(strategy) > 0 && spec.RollingUpdate != strategy[0] {
+		spec.RollingUpdate = strategy[0]
+		pgCtrl.Lock()
+		pgCtrl.spec.RollingUpdate = strategy[0]
+		pgCtrl.Unlock()
+		pgCtrl.opsChan <- pgOperSaveStore{true}
+	}
 	if spec.Pod.Equals(podSpec) {
 		return
 	}
 
+	prevSpec := spec.Clone()
 	oldPodSpec := spec.Pod.Clone()
 	spec.Pod = spec.Pod.Merge(podSpec)
 	spec.Version += 1
@@ -149,25 +216,157 @@ func (pgCtrl *podGroupController) RescheduleSpec(podSpec PodSpec) {
 	pgCtrl.Unlock()
 	pgCtrl.opsChan <- pgOperLogOperation{"Start to reschedule spec"}
 	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSaveRevision{spec.Version, spec.Pod}
 	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
-
+	instanceNos := make([]int, 0, spec.NumInstances)
 	for i := 0; i < spec.NumInstances; i += 1 {
-		pgCtrl.opsChan <- pgOperUpgradeInstance{i + 1, spec.Version, oldPodSpec, spec.Pod}
-		// wait some seconds for new instance's initialization completed, before we update next one
-		time.Sleep(time.Second * time.Duration(podSpec.GetSetupTime()))
+		instanceNos = append(instanceNos, i+1)
 	}
+	pgCtrl.rollingUpgrade(prevSpec, instanceNos, spec.Version, oldPodSpec, spec.Pod)
 	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
 	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
 	pgCtrl.opsChan <- pgOperSaveStore{true}
 	pgCtrl.opsChan <- pgOperLogOperation{"Reschedule spec finished"}
 }
 
+// History returns the stored spec revisions of the pod group, the oldest first
+func (pgCtrl *podGroupController) History(store storage.Store) ([]PodGroupRevision, error) {
+	var revisions []PodGroupRevision
+	if err := store.Get(pgCtrl.revisionsKey, &revisions); err != nil && err != storage.ErrNoSuchKey {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// rollingUpgrade splits the instances into batches by the rolling update strategy, every batch
+// will surge some new instances beside the old ones and replace the others in place.
+// The rollout will be rolled back to prevSpec if too many instances fail to come up.
+func (pgCtrl *podGroupController) rollingUpgrade(prevSpec PodGroupSpec, instanceNos []int, version int, oldPodSpec, newPodSpec PodSpec) {
+	if len(instanceNos) == 0 {
+		return
+	}
+	pgCtrl.opsChan <- pgOperBeginRollout{prevSpec, prevSpec.InstanceVersion(instanceNos[0]), version}
+	surge, unavailable := prevSpec.RolloutBatch(len(instanceNos), oldPodSpec, newPodSpec)
+	batchSize := surge + unavailable
+	for i := 0; i < len(instanceNos); i += batchSize {
+		end := i + batchSize
+		if end > len(instanceNos) {
+			end = len(instanceNos)
+		}
+		setupTime := 0
+		if end < len(instanceNos) {
+			// wait some seconds for new instances' initialization completed, before we update next batch
+			setupTime = newPodSpec.GetSetupTime()
+		}
+		pgCtrl.opsChan <- pgOperUpgradeBatch{instanceNos[i:end], surge, version, oldPodSpec, newPodSpec, setupTime, prevSpec.RollingUpdate.GetRemoveDelay()}
+	}
+	pgCtrl.opsChan <- pgOperEndRollout{}
+}
+
+func (pgCtrl *podGroupController) StartCanary(podSpec PodSpec, numInstances int) {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Canary != nil {
+		return
+	}
+	if numInstances > spec.NumInstances {
+		numInstances = spec.NumInstances
+	}
+	prevSpec := spec.Clone()
+	canaryPod := spec.Pod.Merge(podSpec)
+	canaryPod.Version = spec.Version + 1
+	spec.Canary = &CanarySpec{
+		Pod:          canaryPod,
+		NumInstances: numInstances,
+	}
+	spec.UpdatedAt = time.Now()
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{fmt.Sprintf("Start to deploy canary version %d on %d instances", canaryPod.Version, numInstances)}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	instanceNos := make([]int, 0, numInstances)
+	for i := 0; i < numInstances; i += 1 {
+		instanceNos = append(instanceNos, i+1)
+	}
+	pgCtrl.rollingUpgrade(prevSpec, instanceNos, canaryPod.Version, spec.Pod, canaryPod)
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Deploy canary finished"}
+}
+
+func (pgCtrl *podGroupController) PromoteCanary() {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Canary == nil {
+		return
+	}
+	prevSpec := spec.Clone()
+	canary := *spec.Canary
+	oldPodSpec := spec.Pod.Clone()
+	spec.Pod = canary.Pod
+	spec.Version = canary.Pod.Version
+	spec.UpdatedAt = time.Now()
+	spec.Canary = nil
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{fmt.Sprintf("Start to promote canary version %d", spec.Version)}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSaveRevision{spec.Version, spec.Pod}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	instanceNos := make([]int, 0, spec.NumInstances)
+	for i := canary.NumInstances; i < spec.NumInstances; i += 1 {
+		instanceNos = append(instanceNos, i+1)
+	}
+	pgCtrl.rollingUpgrade(prevSpec, instanceNos, spec.Version, oldPodSpec, spec.Pod)
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Promote canary finished"}
+}
+
+func (pgCtrl *podGroupController) AbortCanary() {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Canary == nil {
+		return
+	}
+	prevSpec := spec.Clone()
+	canary := *spec.Canary
+	spec.Canary = nil
+	spec.UpdatedAt = time.Now()
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{fmt.Sprintf("Start to abort canary version %d", canary.Pod.Version)}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
+	instanceNos := make([]int, 0, canary.NumInstances)
+	for i := 0; i < canary.NumInstances && i < spec.NumInstances; i += 1 {
+		instanceNos = append(instanceNos, i+1)
+	}
+	pgCtrl.rollingUpgrade(prevSpec, instanceNos, spec.Version, canary.Pod, spec.Pod)
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Abort canary finished"}
+}
+
 func (pgCtrl *podGroupController) RescheduleDrift(fromNode, toNode string, instanceNo int, force bool) {
 	pgCtrl.RLock()
 	spec := pgCtrl.spec.Clone()
 	pgCtrl.RUnlock()
 
-	if spec.NumInstances == 0 {
+	if spec.NumInstances == 0 || spec.Stopped {
 		return
 	}
 
@@ -200,8 +399,83 @@ func (pgCtrl *podGroupController) Remove() {
 	pgCtrl.opsChan <- pgOperPurge{}
 }
 
+func (pgCtrl *podGroupController) Stop() {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Stopped {
+		return
+	}
+	spec.Stopped = true
+	spec.UpdatedAt = time.Now()
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{"Start to stop"}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	if spec.IsCron() {
+		// no more runs will be started, the active ones are left alone
+		return
+	}
+	for i := 0; i < spec.NumInstances; i += 1 {
+		pgCtrl.opsChan <- pgOperStopInstance{i + 1}
+	}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Stop finished"}
+}
+
+func (pgCtrl *podGroupController) Start() {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if !spec.Stopped {
+		return
+	}
+	spec.Stopped = false
+	spec.UpdatedAt = time.Now()
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	pgCtrl.opsChan <- pgOperLogOperation{"Start to start"}
+	if spec.IsCron() {
+		pgCtrl.opsChan <- pgOperSaveStore{true}
+		return
+	}
+	for i := 0; i < spec.NumInstances; i += 1 {
+		pgCtrl.opsChan <- pgOperStartInstance{i + 1}
+	}
+	pgCtrl.opsChan <- pgOperSnapshotGroup{true}
+	pgCtrl.opsChan <- pgOperSnapshotPrevState{}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+	pgCtrl.opsChan <- pgOperLogOperation{"Start finished"}
+}
+
+func (pgCtrl *podGroupController) SetPaused(paused bool) {
+	pgCtrl.RLock()
+	spec := pgCtrl.spec.Clone()
+	pgCtrl.RUnlock()
+
+	if spec.Paused == paused {
+		return
+	}
+	spec.Paused = paused
+	spec.UpdatedAt = time.Now()
+	pgCtrl.Lock()
+	pgCtrl.spec = spec
+	pgCtrl.Unlock()
+	if paused {
+		pgCtrl.opsChan <- pgOperLogOperation{"Auto healing paused"}
+	} else {
+		pgCtrl.opsChan <- pgOperLogOperation{"Auto healing resumed"}
+	}
+	pgCtrl.opsChan <- pgOperSaveStore{true}
+}
+
 func (pgCtrl *podGroupController) Refresh(force bool) {
-	if pgCtrl.IsRemoved() || pgCtrl.IsPending() {
+	if pgCtrl.IsRemoved() || pgCtrl.IsPending() || pgCtrl.IsStopped() {
 		return
 	}
 
@@ -209,6 +483,14 @@ func (pgCtrl *podGroupController) Refresh(force bool) {
 	spec := pgCtrl.spec.Clone()
 	pgCtrl.RUnlock()
 
+	if spec.IsCron() {
+		// the runs are refreshed as the job pod groups of their own
+		return
+	}
+	if spec.IsJob() {
+		pgCtrl.refreshJob(spec, force)
+		return
+	}
 	pgCtrl.opsChan <- pgOperLogOperation{"Start to refresh PodGroup"}
 	pgCtrl.opsChan <- pgOperSnapshotEagleView{spec.Name}
 	for i := 0; i < spec.NumInstances; i += 1 {
@@ -243,7 +525,21 @@ func (pgCtrl *podGroupController) emitChangeEvent(changeType string, spec PodSpe
 	if changeType == "" || nodeName == "" {
 		return
 	}
-	var events []interface{}
+	events := dependencyEvents(changeType, spec, nodeName)
+	log.Debugf("%s emit change event: %s, %q, #evts=%d", pgCtrl, changeType, nodeName, len(events))
+	for _, evt := range events {
+		pgCtrl.EmitEvent(evt)
+	}
+	if (changeType == "add" || changeType == "verify") && len(instanceVolumePaths(spec, pod.InstanceNo)) > 0 {
+		pgCtrl.RLock()
+		retention := pgCtrl.spec.VolumeRetention
+		pgCtrl.RUnlock()
+		pgCtrl.EmitEvent(VolumeEvent{changeType, spec, pod.InstanceNo, nodeName, retention})
+	}
+}
+
+func dependencyEvents(changeType string, spec PodSpec, nodeName string) []DependencyEvent {
+	var events []DependencyEvent
 	namespace := spec.Namespace
 	for _, dep := range spec.Dependencies {
 		if dep.Policy == DependencyNodeLevel {
@@ -256,10 +552,7 @@ func (pgCtrl *podGroupController) emitChangeEvent(changeType string, spec PodSpe
 			Namespace: namespace,
 		})
 	}
-	log.Debugf("%s emit change event: %s, %q, #evts=%d", pgCtrl, changeType, nodeName, len(events))
-	for _, evt := range events {
-		pgCtrl.EmitEvent(evt)
-	}
+	return events
 }
 
 func newPodGroupController(spec PodGroupSpec, states []PodPrevState, pg PodGroup) *podGroupController {
@@ -268,15 +561,19 @@ func newPodGroupController(spec PodGroupSpec, states []PodPrevState, pg PodGroup
 		var pod Pod
 		pod.InstanceNo = i + 1
 		pod.State = RunStatePending
-		podSpec := spec.Pod.Clone()
+		podSpec := spec.InstancePodSpec(i + 1).Clone()
 		if states != nil && i < len(states) {
 			podSpec.PrevState = states[i].Clone() // set the pod's prev state
 		} else {
 			podSpec.PrevState = NewPodPrevState(1) // set empty prev state
 		}
 		podCtrls[i] = &podController{
-			spec: podSpec,
-			pod:  pod,
+			spec:     podSpec,
+			pod:      pod,
+			spread:   spec.TopologySpread,
+			node:     spec.DaemonNode(i + 1),
+			vacant:   spec.IsVacantInstance(i + 1),
+			hostname: spec.InstanceHostname(i + 1),
 		}
 	}
 	// we may have some running pods loading from the storage
@@ -296,6 +593,7 @@ func newPodGroupController(spec PodGroupSpec, states []PodPrevState, pg PodGroup
 
 		storedKey:    strings.Join([]string{kLainDeploydRootKey, kLainPodGroupKey, spec.Namespace, spec.Name}, "/"),
 		storedKeyDir: strings.Join([]string{kLainDeploydRootKey, kLainPodGroupKey, spec.Namespace}, "/"),
+		revisionsKey: strings.Join([]string{kLainDeploydRootKey, kLainRevisionKey, spec.Namespace, spec.Name}, "/"),
 	}
 	pgCtrl.Publisher = NewPublisher(true)
 	return pgCtrl
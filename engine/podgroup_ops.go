@@ -55,6 +55,44 @@ func (op pgOperRemoveStore) Do(pgCtrl *podGroupController, c cluster.Cluster, st
 	} else {
 		store.TryRemoveDir(pgCtrl.storedKeyDir)
 	}
+	if err := store.Remove(pgCtrl.revisionsKey); err != nil && err != storage.ErrNoSuchKey {
+		log.Warnf("[Store] Failed to remove pod group revisions %s, %s", pgCtrl.revisionsKey, err)
+	}
+	return false
+}
+
+type pgOperSaveRevision struct {
+	revision int
+	pod      PodSpec
+}
+
+func (op pgOperSaveRevision) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	var _err error
+	start := time.Now()
+	defer func() {
+		pgCtrl.RLock()
+		log.Infof("%s save revision, revision=%d, err=%v, duration=%s", pgCtrl, op.revision, _err, time.Now().Sub(start))
+		pgCtrl.RUnlock()
+	}()
+	revisions, err := pgCtrl.History(store)
+	if err != nil {
+		_err = err
+		return false
+	}
+	newRevisions := make([]PodGroupRevision, 0, len(revisions)+1)
+	for _, revision := range revisions {
+		if revision.Revision != op.revision {
+			newRevisions = append(newRevisions, revision)
+		}
+	}
+	newRevisions = append(newRevisions, PodGroupRevision{op.revision, op.pod.Clone(), time.Now()})
+	if RevisionHistoryLimit > 0 && len(newRevisions) > RevisionHistoryLimit {
+		newRevisions = newRevisions[len(newRevisions)-RevisionHistoryLimit:]
+	}
+	if err := store.Set(pgCtrl.revisionsKey, newRevisions, true); err != nil {
+		log.Warnf("[Store] Failed to save pod group revisions %s, %s", pgCtrl.revisionsKey, err)
+		_err = err
+	}
 	return false
 }
 
@@ -81,10 +119,11 @@ func (op pgOperSnapshotEagleView) Do(pgCtrl *podGroupController, c cluster.Clust
 }
 
 type pgOperUpgradeInstance struct {
-	instanceNo int
-	version    int
-	oldPodSpec PodSpec
-	newPodSpec PodSpec
+	instanceNo  int
+	version     int
+	oldPodSpec  PodSpec
+	newPodSpec  PodSpec
+	removeDelay int
 }
 
 func (op pgOperUpgradeInstance) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
@@ -96,27 +135,415 @@ func (op pgOperUpgradeInstance) Do(pgCtrl *podGroupController, c cluster.Cluster
 	}()
 
 	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
-	newPodSpec := op.newPodSpec.Clone()
-	newPodSpec.PrevState = podCtrl.spec.PrevState.Clone() // upgrade action, state should not changed
-	prevNodeName := newPodSpec.PrevState.NodeName
+	newPodSpec := upgradePodSpec(podCtrl, op.oldPodSpec, op.newPodSpec)
+	if podCtrl.vacant {
+		podCtrl.spec = newPodSpec
+		return false
+	}
 
 	var lowOp pgOperation
 	lowOp = pgOperRemoveInstance{op.instanceNo, op.oldPodSpec}
 	lowOp.Do(pgCtrl, c, store, ev)
-	time.Sleep(10 * time.Second)
-
-	// FIXME: do we need to consider hard state flag on upgrade
-	if op.oldPodSpec.IsStateful() && newPodSpec.IsStateful() && prevNodeName != "" {
-		newPodSpec.Filters = append(newPodSpec.Filters, fmt.Sprintf("constraint:node==%s", prevNodeName))
+	if op.removeDelay > 0 {
+		time.Sleep(time.Duration(op.removeDelay) * time.Second)
 	}
+
 	podCtrl.spec = newPodSpec
 	podCtrl.pod.State = RunStatePending
 	podCtrl.pod.RestartCount = 0
+	podCtrl.pod.NextRestartAt = time.Time{}
 	lowOp = pgOperDeployInstance{op.instanceNo, op.version}
 	lowOp.Do(pgCtrl, c, store, ev)
 	return false
 }
 
+// upgradePodSpec returns the new pod spec for an in place upgrade, which keeps the prev state of the instance
+func upgradePodSpec(podCtrl *podController, oldPodSpec, newPodSpec PodSpec) PodSpec {
+	newSpec := newPodSpec.Clone()
+	newSpec.PrevState = podCtrl.spec.PrevState.Clone() // upgrade action, state should not changed
+	prevNodeName := newSpec.PrevState.NodeName
+	// FIXME: do we need to consider hard state flag on upgrade
+	if oldPodSpec.IsStateful() && newSpec.IsStateful() && prevNodeName != "" {
+		newSpec.Filters = append(newSpec.Filters, nodeFilter(prevNodeName, true))
+	}
+	return newSpec
+}
+
+type pgOperUpgradeBatch struct {
+	instanceNos []int
+	maxSurge    int
+	version     int
+	oldPodSpec  PodSpec
+	newPodSpec  PodSpec
+	setupTime   int
+	removeDelay int
+}
+
+func (op pgOperUpgradeBatch) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	var surged, replaced []int
+	start := time.Now()
+	defer func() {
+		pgCtrl.RLock()
+		log.Infof("%s upgrade batch, iNos=%v, surged=%v, replaced=%v, version=%d, duration=%s",
+			pgCtrl, op.instanceNos, surged, replaced, op.version, time.Now().Sub(start))
+		pgCtrl.RUnlock()
+	}()
+
+	if pgCtrl.isRolloutHalted() {
+		return false
+	}
+
+	// the vacant daemon slots only take the new spec
+	instanceNos := make([]int, 0, len(op.instanceNos))
+	for _, instanceNo := range op.instanceNos {
+		if podCtrl := pgCtrl.podCtrls[instanceNo-1]; podCtrl.vacant {
+			podCtrl.spec = upgradePodSpec(podCtrl, op.oldPodSpec, op.newPodSpec)
+		} else {
+			instanceNos = append(instanceNos, instanceNo)
+		}
+	}
+
+	// deploy the surge instances beside the old ones first, so we will not lose any capacity
+	surgeCtrls := make(map[int]*podController)
+	var surgedCtrls []*podController
+	var inPlaceNos []int
+	for i, instanceNo := range instanceNos {
+		if i >= op.maxSurge {
+			inPlaceNos = append(inPlaceNos, instanceNo)
+			continue
+		}
+		surgeCtrl := pgCtrl.deploySurgeInstance(c, instanceNo, op.version, op.newPodSpec, surgedCtrls...)
+		if surgeCtrl.pod.State != RunStateSuccess || !pgCtrl.waitInstanceReady(c, instanceNo, surgeCtrl) {
+			pgCtrl.RLock()
+			log.Warnf("%s failed to surge new instance, iNo=%d, keep the old one running, %s", pgCtrl, instanceNo, surgeCtrl.pod.LastError)
+			pgCtrl.RUnlock()
+			surgeCtrl.Remove(c)
+			pgCtrl.recordRolloutOutcome(instanceNo, false, false)
+			continue
+		}
+		surgeCtrls[instanceNo] = surgeCtrl
+		surgedCtrls = append(surgedCtrls, surgeCtrl)
+	}
+
+	// the rest instances are removed and deployed in place
+	if len(inPlaceNos) > 0 {
+		newSpecs := make([]PodSpec, len(inPlaceNos))
+		for i, instanceNo := range inPlaceNos {
+			newSpecs[i] = upgradePodSpec(pgCtrl.podCtrls[instanceNo-1], op.oldPodSpec, op.newPodSpec)
+			pgOperRemoveInstance{instanceNo, op.oldPodSpec}.Do(pgCtrl, c, store, ev)
+		}
+		if op.removeDelay > 0 {
+			time.Sleep(time.Duration(op.removeDelay) * time.Second)
+		}
+		for i, instanceNo := range inPlaceNos {
+			podCtrl := pgCtrl.podCtrls[instanceNo-1]
+			podCtrl.spec = newSpecs[i]
+			podCtrl.pod.State = RunStatePending
+			podCtrl.pod.RestartCount = 0
+			podCtrl.pod.NextRestartAt = time.Time{}
+			pgOperDeployInstance{instanceNo, op.version}.Do(pgCtrl, c, store, ev)
+		}
+		for _, instanceNo := range inPlaceNos {
+			podCtrl := pgCtrl.podCtrls[instanceNo-1]
+			success := podCtrl.pod.State == RunStateSuccess && pgCtrl.waitInstanceReady(c, instanceNo, podCtrl)
+			pgCtrl.recordRolloutOutcome(instanceNo, true, success)
+			replaced = append(replaced, instanceNo)
+		}
+	}
+
+	// retire the old instances which already have their new ones running
+	for _, instanceNo := range instanceNos {
+		surgeCtrl, ok := surgeCtrls[instanceNo]
+		if !ok {
+			continue
+		}
+		pgOperRemoveInstance{instanceNo, op.oldPodSpec}.Do(pgCtrl, c, store, ev)
+		pgCtrl.Lock()
+		pgCtrl.podCtrls[instanceNo-1] = surgeCtrl
+		pgCtrl.Unlock()
+		pod := surgeCtrl.pod.Clone()
+		pgCtrl.emitChangeEvent("add", surgeCtrl.spec, pod, pod.NodeName())
+		pgCtrl.recordRolloutOutcome(instanceNo, true, true)
+		surged = append(surged, instanceNo)
+	}
+
+	if pgCtrl.isRolloutFailed() {
+		pgCtrl.rollbackRollout(c, store, ev)
+		return false
+	}
+	if op.newPodSpec.Readiness == nil && op.setupTime > 0 {
+		time.Sleep(time.Second * time.Duration(op.setupTime))
+	}
+	return false
+}
+
+// waitInstanceReady waits for the new instance passing the readiness probe until the readiness deadline,
+// returns true directly if there is no readiness probe.
+func (pgCtrl *podGroupController) waitInstanceReady(c cluster.Cluster, instanceNo int, podCtrl *podController) bool {
+	probe := podCtrl.spec.Readiness
+	if probe == nil {
+		return true
+	}
+	if len(podCtrl.pod.Containers) == 0 {
+		return false
+	}
+	pgCtrl.setRolloutBlockedOn(instanceNo)
+	defer pgCtrl.setRolloutBlockedOn(0)
+
+	container := podCtrl.pod.Containers[0]
+	deadline := time.Now().Add(podCtrl.spec.GetReadinessDeadline())
+	interval := time.Duration(probe.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	time.Sleep(time.Duration(probe.InitialDelay) * time.Second)
+	successes := 0
+	for {
+		if err := probe.probe(c, container.Id, container.ContainerIp); err != nil {
+			successes = 0
+			podCtrl.pod.LastError = fmt.Sprintf("Readiness check failed, %s", err)
+		} else {
+			successes += 1
+			if successes >= probe.GetSuccessThreshold() {
+				podCtrl.pod.LastError = ""
+				return true
+			}
+		}
+		if time.Now().Add(interval).After(deadline) {
+			pgCtrl.RLock()
+			log.Warnf("%s instance is not ready before the deadline, iNo=%d, %s", pgCtrl, instanceNo, podCtrl.pod.LastError)
+			pgCtrl.RUnlock()
+			return false
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (pgCtrl *podGroupController) setRolloutBlockedOn(instanceNo int) {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	if pgCtrl.group.Rollout != nil {
+		pgCtrl.group.Rollout.BlockedOn = instanceNo
+	}
+	if instanceNo > 0 {
+		pgCtrl.group.LastError = fmt.Sprintf("Rollout is waiting for instance %d to be ready", instanceNo)
+	} else {
+		pgCtrl.group.LastError = ""
+	}
+}
+
+type pgOperBeginRollout struct {
+	prevSpec    PodGroupSpec
+	fromVersion int
+	toVersion   int
+}
+
+func (op pgOperBeginRollout) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	pgCtrl.rolloutPrevSpec = op.prevSpec.Clone()
+	pgCtrl.group.Rollout = &RolloutStatus{
+		FromVersion: op.fromVersion,
+		ToVersion:   op.toVersion,
+		State:       RolloutStateUpgrading,
+		StartedAt:   time.Now(),
+	}
+	return false
+}
+
+type pgOperEndRollout struct{}
+
+func (op pgOperEndRollout) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	if rollout := pgCtrl.group.Rollout; rollout != nil && rollout.State == RolloutStateUpgrading {
+		rollout.State = RolloutStateFinished
+		rollout.FinishedAt = time.Now()
+	}
+	return false
+}
+
+type pgOperBeginOperation struct {
+	opId string
+}
+
+func (op pgOperBeginOperation) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	pgCtrl.runningOperation = op.opId
+	pgCtrl.operationStartedAt = time.Now()
+	pgCtrl.operationTouched = make(map[int]bool)
+	opsTracker.Start(op.opId)
+	return false
+}
+
+type pgOperEndOperation struct {
+	opId string
+}
+
+func (op pgOperEndOperation) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	pgCtrl.finishOperation(op.opId)
+	return false
+}
+
+// finishOperation collects the instance results of the running operation, should be called with the lock held
+func (pgCtrl *podGroupController) finishOperation(opId string) {
+	if opId == "" || pgCtrl.runningOperation != opId {
+		return
+	}
+	var errMsg string
+	results := make([]InstanceResult, len(pgCtrl.podCtrls))
+	for i, podCtrl := range pgCtrl.podCtrls {
+		pod := podCtrl.pod
+		results[i] = InstanceResult{pod.InstanceNo, pod.State, pod.LastError}
+		// the instances failed before the operation are not the failures of it
+		if !pgCtrl.operationTouched[pod.InstanceNo] {
+			continue
+		}
+		if errMsg == "" && pod.LastError != "" && (pod.State == RunStateFail || pod.State == RunStateMissing) {
+			errMsg = fmt.Sprintf("Instance %d: %s", pod.InstanceNo, pod.LastError)
+		}
+	}
+	if rollout := pgCtrl.group.Rollout; rollout != nil && rollout.State == RolloutStateRolledBack &&
+		!rollout.FinishedAt.Before(pgCtrl.operationStartedAt) {
+		errMsg = fmt.Sprintf("Rollout rolled back, %s", pgCtrl.group.LastError)
+	}
+	opsTracker.Finish(opId, results, errMsg)
+	pgCtrl.runningOperation = ""
+	pgCtrl.operationTouched = nil
+}
+
+// touchInstance records the instance acted on by the running operation
+func (pgCtrl *podGroupController) touchInstance(instanceNo int) {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	if pgCtrl.operationTouched != nil {
+		pgCtrl.operationTouched[instanceNo] = true
+	}
+}
+
+func (pgCtrl *podGroupController) isRolloutHalted() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	rollout := pgCtrl.group.Rollout
+	return rollout != nil && rollout.State != RolloutStateUpgrading
+}
+
+func (pgCtrl *podGroupController) isRolloutFailed() bool {
+	pgCtrl.RLock()
+	defer pgCtrl.RUnlock()
+	rollout := pgCtrl.group.Rollout
+	return rollout != nil && rollout.State == RolloutStateUpgrading &&
+		len(rollout.Failed) >= pgCtrl.spec.RollingUpdate.FailureThreshold()
+}
+
+// recordRolloutOutcome records the instance result of the running rollout, upgraded means the old instance
+// has been replaced, so it needs to be redeployed with the old version when rolling back.
+func (pgCtrl *podGroupController) recordRolloutOutcome(instanceNo int, upgraded bool, success bool) {
+	pgCtrl.Lock()
+	defer pgCtrl.Unlock()
+	rollout := pgCtrl.group.Rollout
+	if rollout == nil || rollout.State != RolloutStateUpgrading {
+		return
+	}
+	if upgraded {
+		rollout.Upgraded = append(rollout.Upgraded, instanceNo)
+	}
+	if !success {
+		rollout.Failed = append(rollout.Failed, instanceNo)
+	}
+}
+
+// rollbackRollout reverts the spec to the one before the rollout, and redeploys the upgraded instances with the old version
+func (pgCtrl *podGroupController) rollbackRollout(c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) {
+	pgCtrl.Lock()
+	failedSpec := pgCtrl.spec.Clone()
+	spec := pgCtrl.spec.Clone()
+	spec.Pod = pgCtrl.rolloutPrevSpec.Pod.Clone()
+	spec.Version = pgCtrl.rolloutPrevSpec.Version
+	spec.Canary = nil
+	if pgCtrl.rolloutPrevSpec.Canary != nil {
+		canary := pgCtrl.rolloutPrevSpec.Canary.Clone()
+		spec.Canary = &canary
+	}
+	spec.UpdatedAt = time.Now()
+	pgCtrl.spec = spec
+	rollout := pgCtrl.group.Rollout
+	rollout.State = RolloutStateRolledBack
+	rollout.FinishedAt = time.Now()
+	upgraded := make([]int, len(rollout.Upgraded))
+	copy(upgraded, rollout.Upgraded)
+	failed := make([]int, len(rollout.Failed))
+	copy(failed, rollout.Failed)
+	fromVersion, toVersion := rollout.FromVersion, rollout.ToVersion
+	log.Warnf("%s rollout failed on instances %v, roll back to version %d", pgCtrl, failed, fromVersion)
+	pgCtrl.Unlock()
+
+	for _, instanceNo := range upgraded {
+		if instanceNo > len(pgCtrl.podCtrls) {
+			continue
+		}
+		op := pgOperUpgradeInstance{instanceNo, spec.InstanceVersion(instanceNo), failedSpec.InstancePodSpec(instanceNo),
+			spec.InstancePodSpec(instanceNo), spec.RollingUpdate.GetRemoveDelay()}
+		op.Do(pgCtrl, c, store, ev)
+	}
+	pgOperSnapshotGroup{true}.Do(pgCtrl, c, store, ev)
+	pgOperSaveStore{true}.Do(pgCtrl, c, store, ev)
+	ntfController.Send(NewNotifySpec(spec.Namespace, spec.Name, failed[0],
+		fmt.Sprintf(NotifyRolloutFailed, fromVersion, toVersion, failed, fromVersion)))
+}
+
+// deploySurgeInstance deploys a new version instance beside the running one with the same instance number,
+// the container name is different since it carries the new version.
+// The surged instances of the same batch are not in the pod controllers yet, they are counted in the placements.
+func (pgCtrl *podGroupController) deploySurgeInstance(c cluster.Cluster, instanceNo int, version int, podSpec PodSpec,
+	surged ...*podController) *podController {
+	oldCtrl := pgCtrl.podCtrls[instanceNo-1]
+	spec := podSpec.Clone()
+	// the old instance still holds the ips, let the new instance get new ones
+	spec.PrevState = NewPodPrevState(len(spec.Containers))
+	var pod Pod
+	pod.InstanceNo = instanceNo
+	pod.DriftCount = oldCtrl.pod.DriftCount
+	pod.State = RunStatePending
+	surgeCtrl := &podController{
+		spec:     spec,
+		pod:      pod,
+		spread:   pgCtrl.spec.TopologySpread,
+		node:     oldCtrl.node,
+		hostname: oldCtrl.hostname,
+	}
+	if containerIds, ok := pgCtrl.findDeployedContainers(instanceNo, version, len(spec.Containers)); ok {
+		surgeCtrl.pod.Containers = make([]Container, len(containerIds))
+		for i, cId := range containerIds {
+			surgeCtrl.pod.Containers[i].Id = cId
+		}
+		surgeCtrl.Refresh(c)
+	} else {
+		surgeCtrl.Deploy(c, pgCtrl.placements(surgeCtrl, surged...))
+	}
+	return surgeCtrl
+}
+
+// findDeployedContainers finds the container ids of the instance with the given version from eagle view snapshot
+func (pgCtrl *podGroupController) findDeployedContainers(instanceNo int, version int, numContainers int) ([]string, bool) {
+	containerIds := make([]string, numContainers)
+	foundDeployed := false
+	for _, podContainer := range pgCtrl.evSnapshot {
+		if podContainer.InstanceNo == instanceNo && podContainer.Version == version {
+			cId := podContainer.Container.Id
+			cIndex := podContainer.ContainerIndex
+			if cIndex >= 0 && cIndex < numContainers {
+				containerIds[cIndex] = cId
+				foundDeployed = true
+			}
+		}
+	}
+	return containerIds, foundDeployed
+}
+
 type pgOperRefreshInstance struct {
 	instanceNo int
 	spec       PodGroupSpec
@@ -132,6 +559,10 @@ func (op pgOperRefreshInstance) Do(pgCtrl *podGroupController, c cluster.Cluster
 	}()
 
 	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	if podCtrl.vacant {
+		return false
+	}
+	version := op.spec.InstanceVersion(op.instanceNo)
 
 	podCtrl.Refresh(c)
 	runtime = podCtrl.pod.ImRuntime
@@ -150,13 +581,18 @@ func (op pgOperRefreshInstance) Do(pgCtrl *podGroupController, c cluster.Cluster
 	}
 
 	if runtime.State == RunStateSuccess {
-		if generics.Equal_StringSlice(evIds, podCtrl.pod.ContainerIds()) && op.spec.Version == evVersion {
+		if generics.Equal_StringSlice(evIds, podCtrl.pod.ContainerIds()) && version == evVersion {
 			pod := podCtrl.pod.Clone()
 			pgCtrl.emitChangeEvent("verify", podCtrl.spec, pod, pod.NodeName())
 			return false
 		}
 	}
 
+	if !op.spec.IsAutoHealing() {
+		// only snapshot the runtime for inspection, leave the instance as it is
+		return false
+	}
+
 	if runtime.State == RunStateMissing {
 		foundRuntime := false
 		for i, cId := range evIds {
@@ -178,39 +614,66 @@ func (op pgOperRefreshInstance) Do(pgCtrl *podGroupController, c cluster.Cluster
 			ntfController.Send(NewNotifySpec(podCtrl.spec.Namespace, podCtrl.spec.Name, op.instanceNo, NotifyPodMissing))
 			newPodSpec := podCtrl.spec.Clone()
 			prevNodeName := newPodSpec.PrevState.NodeName
-			if newPodSpec.IsHardStateful() {
+			if op.spec.Ordered {
+				if blocker := pgCtrl.orderedBlocker(op.instanceNo); blocker > 0 {
+					log.Warnf("PodGroupCtrl %s, instance %d is not running, will redeploy instance %d later", op.spec, blocker, op.instanceNo)
+					podCtrl.pod.LastError = fmt.Sprintf("Waiting for instance %d to be ready", blocker)
+					return false
+				}
+			}
+			// the ordered instance which has never been placed has nothing to lose
+			if newPodSpec.IsHardStateful() && !(op.spec.Ordered && prevNodeName == "") {
 				// we don't do anything
 				log.Warnf("PodGroupCtrl %s, we found hard state pod missing, will leave it there, please ping admins", op.spec)
 				return false
 			}
 			if newPodSpec.IsStateful() && prevNodeName != "" {
-				newPodSpec.Filters = append(newPodSpec.Filters, fmt.Sprintf("constraint:node==%s", prevNodeName))
+				newPodSpec.Filters = append(newPodSpec.Filters, nodeFilter(prevNodeName, true))
 			}
 			podCtrl.spec = newPodSpec
 			podCtrl.pod.State = RunStatePending
-			op := pgOperDeployInstance{op.instanceNo, op.spec.Version}
+			ordered, instanceNo := op.spec.Ordered, op.instanceNo
+			op := pgOperDeployInstance{op.instanceNo, version}
 			op.Do(pgCtrl, c, store, ev)
+			if ordered && podCtrl.pod.State == RunStateSuccess && !pgCtrl.waitInstanceReady(c, instanceNo, podCtrl) {
+				// the later instances will wait for it
+				podCtrl.pod.State = RunStateFail
+			}
 			runtime = podCtrl.pod.ImRuntime
 		}
 		return false
 	}
 
-	if (evVersion != -1 && op.spec.Version != evVersion) || podCtrl.spec.Version != op.spec.Version {
-		log.Warnf("PodGroupCtrl %s, we found pod running with lower version, just upgrade it", op.spec)
-		// the new spec should be in op.spec.Pod
-		op := pgOperUpgradeInstance{op.instanceNo, op.spec.Version, podCtrl.spec, op.spec.Pod}
+	if (evVersion != -1 && version != evVersion) || podCtrl.spec.Version != version {
+		log.Warnf("PodGroupCtrl %s, we found pod running with different version, just upgrade it", op.spec)
+		// the new spec should be in op.spec.Pod, or in the canary spec for canary instances
+		op := pgOperUpgradeInstance{op.instanceNo, version, podCtrl.spec, op.spec.InstancePodSpec(op.instanceNo), op.spec.RollingUpdate.GetRemoveDelay()}
 		op.Do(pgCtrl, c, store, ev)
 		runtime = podCtrl.pod.ImRuntime
 		return false
 	}
 	if podCtrl.pod.NeedRestart(op.spec.RestartPolicy) {
-		if podCtrl.pod.RestartEnoughTimes() {
+		if podCtrl.pod.RestartEnoughTimes(op.spec.GetRestartMaxCount()) {
+			podCtrl.pod.State = RunStateCrashLoop
+			runtime = podCtrl.pod.ImRuntime
 			ntfController.Send(NewNotifySpec(podCtrl.spec.Namespace, podCtrl.spec.Name, op.instanceNo, NotifyLetPodGo))
 			return false
 		}
-		log.Warnf("PodGroupCtrl %s, we found pod down, just restart it", op.spec)
-		ntfController.Send(NewNotifySpec(podCtrl.spec.Namespace, podCtrl.spec.Name, op.instanceNo, NotifyPodDown))
+		if time.Now().Before(podCtrl.pod.NextRestartAt) {
+			log.Infof("PodGroupCtrl %s, we found pod down, backing off until %s", op.spec, podCtrl.pod.NextRestartAt)
+			podCtrl.pod.State = RunStateCrashLoop
+			runtime = podCtrl.pod.ImRuntime
+			return false
+		}
+		if podCtrl.pod.State == RunStateUnhealthy {
+			log.Warnf("PodGroupCtrl %s, we found pod unhealthy, just restart it", op.spec)
+			ntfController.Send(NewNotifySpec(podCtrl.spec.Namespace, podCtrl.spec.Name, op.instanceNo, NotifyPodUnhealthy))
+		} else {
+			log.Warnf("PodGroupCtrl %s, we found pod down, just restart it", op.spec)
+			ntfController.Send(NewNotifySpec(podCtrl.spec.Namespace, podCtrl.spec.Name, op.instanceNo, NotifyPodDown))
+		}
 		podCtrl.Start(c)
+		podCtrl.pod.NextRestartAt = podCtrl.pod.RestartAt.Add(op.spec.RestartBackoff.Delay(podCtrl.pod.RestartCount))
 		runtime = podCtrl.pod.ImRuntime
 		if runtime.State == RunStateSuccess {
 			pod := podCtrl.pod.Clone()
@@ -222,6 +685,61 @@ func (op pgOperRefreshInstance) Do(pgCtrl *podGroupController, c cluster.Cluster
 	return false
 }
 
+type pgOperStopInstance struct {
+	instanceNo int
+}
+
+func (op pgOperStopInstance) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	var runtime ImRuntime
+	start := time.Now()
+	defer func() {
+		pgCtrl.RLock()
+		log.Infof("%s stop instance, iNo=%d, runtime=%+v, duration=%s", pgCtrl, op.instanceNo, runtime, time.Now().Sub(start))
+		pgCtrl.RUnlock()
+	}()
+
+	pgCtrl.touchInstance(op.instanceNo)
+	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	if podCtrl.vacant {
+		return false
+	}
+	podCtrl.Stop(c)
+	runtime = podCtrl.pod.ImRuntime
+	pod := podCtrl.pod.Clone()
+	pgCtrl.emitChangeEvent("remove", podCtrl.spec, pod, pod.NodeName())
+	return false
+}
+
+type pgOperStartInstance struct {
+	instanceNo int
+}
+
+func (op pgOperStartInstance) Do(pgCtrl *podGroupController, c cluster.Cluster, store storage.Store, ev *RuntimeEagleView) bool {
+	var runtime ImRuntime
+	start := time.Now()
+	defer func() {
+		pgCtrl.RLock()
+		log.Infof("%s start instance, iNo=%d, runtime=%+v, duration=%s", pgCtrl, op.instanceNo, runtime, time.Now().Sub(start))
+		pgCtrl.RUnlock()
+	}()
+
+	pgCtrl.touchInstance(op.instanceNo)
+	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
+	if podCtrl.vacant {
+		return false
+	}
+	podCtrl.Start(c)
+	// started on purpose, not a restart
+	podCtrl.pod.RestartCount = 0
+	podCtrl.pod.NextRestartAt = time.Time{}
+	runtime = podCtrl.pod.ImRuntime
+	if runtime.State == RunStateSuccess {
+		pod := podCtrl.pod.Clone()
+		pgCtrl.emitChangeEvent("add", podCtrl.spec, pod, pod.NodeName())
+	}
+	return false
+}
+
 type pgOperVerifyInstanceCount struct {
 	spec PodGroupSpec
 }
@@ -235,6 +753,9 @@ func (op pgOperVerifyInstanceCount) Do(pgCtrl *podGroupController, c cluster.Clu
 		pgCtrl.RUnlock()
 	}()
 
+	if !op.spec.IsAutoHealing() {
+		return false
+	}
 	for _, podContainer := range pgCtrl.evSnapshot {
 		if podContainer.InstanceNo > op.spec.NumInstances {
 			cId := podContainer.Container.Id
@@ -265,19 +786,12 @@ func (op pgOperDeployInstance) Do(pgCtrl *podGroupController, c cluster.Cluster,
 		log.Infof("%s deploy instance, op=%+v, runtime=%+v, duration=%s", pgCtrl, op, runtime, time.Now().Sub(start))
 		pgCtrl.RUnlock()
 	}()
+	pgCtrl.touchInstance(op.instanceNo)
 	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
-	containerIds := make([]string, len(podCtrl.spec.Containers))
-	foundDeployed := false
-	for _, podContainer := range pgCtrl.evSnapshot {
-		if podContainer.InstanceNo == op.instanceNo && podContainer.Version == op.version {
-			cId := podContainer.Container.Id
-			cIndex := podContainer.ContainerIndex
-			if cIndex >= 0 && cIndex < len(podCtrl.spec.Containers) {
-				containerIds[cIndex] = cId
-				foundDeployed = true
-			}
-		}
+	if podCtrl.vacant {
+		return false
 	}
+	containerIds, foundDeployed := pgCtrl.findDeployedContainers(op.instanceNo, op.version, len(podCtrl.spec.Containers))
 	if foundDeployed {
 		corrupted := false
 		if len(podCtrl.pod.Containers) != len(containerIds) {
@@ -308,7 +822,7 @@ func (op pgOperDeployInstance) Do(pgCtrl *podGroupController, c cluster.Cluster,
 			pgCtrl.emitChangeEvent("verify", podCtrl.spec, pod, pod.NodeName())
 		}
 	} else {
-		podCtrl.Deploy(c)
+		podCtrl.Deploy(c, pgCtrl.placements(podCtrl))
 		runtime = podCtrl.pod.ImRuntime
 		if runtime.State == RunStateSuccess {
 			pod := podCtrl.pod.Clone()
@@ -336,11 +850,24 @@ func (op pgOperSnapshotGroup) Do(pgCtrl *podGroupController, c cluster.Cluster,
 	group.Pods = make([]Pod, spec.NumInstances)
 	for i, podCtrl := range pgCtrl.podCtrls {
 		group.Pods[i] = podCtrl.pod
-		if podCtrl.pod.State != RunStateSuccess {
+		group.Pods[i].Version = podCtrl.spec.Version
+		if podCtrl.pod.State != RunStateSuccess && !podCtrl.vacant {
 			group.State = podCtrl.pod.State
 			group.LastError = podCtrl.pod.LastError
 		}
 	}
+	if job := group.Job; job != nil {
+		// the pending and exited instances are expected for the job
+		group.LastError = job.Reason
+		switch job.State {
+		case JobStateSucceeded:
+			group.State = RunStateExit
+		case JobStateFailed:
+			group.State = RunStateFail
+		default:
+			group.State = RunStateSuccess
+		}
+	}
 	if op.updateTime {
 		group.UpdatedAt = time.Now()
 	}
@@ -370,9 +897,10 @@ func (op pgOperDriftInstance) Do(pgCtrl *podGroupController, c cluster.Cluster,
 	oldSpec, oldPod := podCtrl.spec.Clone(), podCtrl.pod
 	oldNodeName := oldPod.NodeName()
 
-	isDrifted = podCtrl.Drift(c, op.fromNode, op.toNode, op.force)
+	isDrifted = podCtrl.Drift(c, op.fromNode, op.toNode, op.force, pgCtrl.placements(podCtrl))
 	runtime = podCtrl.pod.ImRuntime
 	if isDrifted {
+		pgCtrl.touchInstance(op.instanceNo)
 		pgCtrl.emitChangeEvent("remove", oldSpec, oldPod, oldNodeName)
 		pod := podCtrl.pod.Clone()
 		pgCtrl.emitChangeEvent("add", podCtrl.spec, pod, pod.NodeName())
@@ -392,6 +920,7 @@ func (op pgOperRemoveInstance) Do(pgCtrl *podGroupController, c cluster.Cluster,
 		log.Infof("%s remove instance, instanceNo=%d, duration=%s", pgCtrl, op.instanceNo, time.Now().Sub(start))
 		pgCtrl.RUnlock()
 	}()
+	pgCtrl.touchInstance(op.instanceNo)
 	podCtrl := pgCtrl.podCtrls[op.instanceNo-1]
 	nodeName := podCtrl.pod.NodeName()
 	podCtrl.Remove(c)
@@ -425,6 +954,8 @@ func (op pgOperPurge) Do(pgCtrl *podGroupController, c cluster.Cluster, store st
 	pgCtrl.Lock()
 	defer pgCtrl.Unlock()
 	pgCtrl.group.State = RunStateRemoved
+	// the operations queued after purging would never run
+	pgCtrl.finishOperation(pgCtrl.runningOperation)
 	return true // to shutdown the worker routine
 }
 
@@ -437,8 +968,12 @@ func (op pgOperPushPodCtrl) Do(pgCtrl *podGroupController, c cluster.Cluster, st
 	pod.InstanceNo = len(pgCtrl.podCtrls) + 1
 	pod.State = RunStatePending
 	podCtrl := &podController{
-		spec: op.spec,
-		pod:  pod,
+		spec:     op.spec,
+		pod:      pod,
+		spread:   pgCtrl.spec.TopologySpread,
+		node:     pgCtrl.spec.DaemonNode(pod.InstanceNo),
+		vacant:   pgCtrl.spec.IsVacantInstance(pod.InstanceNo),
+		hostname: pgCtrl.spec.InstanceHostname(pod.InstanceNo),
 	}
 	podCtrl.spec.PrevState = NewPodPrevState(1) // set empty prevstate
 	pgCtrl.podCtrls = append(pgCtrl.podCtrls, podCtrl)
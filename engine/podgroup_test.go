@@ -1,5 +1,10 @@
+//go:build integration
+// +build integration
+
 package engine
 
+// the tests need the etcd and the swarm cluster below, run them by go test -tags integration
+
 import (
 	"fmt"
 	"testing"
@@ -27,7 +32,7 @@ func TestPodGroupRefresh(t *testing.T) {
 	name := "hello.proc.web.web"
 	pgSpec := createPodGroupSpec(namespace, name, 2)
 	pgSpec.RestartPolicy = RestartPolicyAlways
-	if err := engine.NewPodGroup(pgSpec); err != nil {
+	if _, err := engine.NewPodGroup(pgSpec); err != nil {
 		t.Fatalf("Should not return error, %s", err)
 	}
 
@@ -51,7 +56,7 @@ func TestPodGroupRefresh(t *testing.T) {
 		t.Errorf("We should have the pod deployed and running, %#v", pg.State)
 	}
 
-	if err := engine.RemovePodGroup(name); err != nil {
+	if _, err := engine.RemovePodGroup(name); err != nil {
 		t.Errorf("We should be able to remove the pod group, %s", err)
 	}
 
@@ -72,10 +77,10 @@ func TestEnginePodGroup(t *testing.T) {
 	namespace := "hello"
 	name := "hello.proc.web.web"
 	pgSpec := createPodGroupSpec(namespace, name, 1)
-	if err := engine.NewPodGroup(pgSpec); err != nil {
+	if _, err := engine.NewPodGroup(pgSpec); err != nil {
 		t.Fatalf("Should not return error, %s", err)
 	}
-	if err := engine.NewPodGroup(pgSpec); err == nil {
+	if _, err := engine.NewPodGroup(pgSpec); err == nil {
 		t.Errorf("Should return exists error, but we got no problem")
 	}
 
@@ -112,9 +117,9 @@ func TestEnginePodGroup(t *testing.T) {
 		t.Errorf("We should have version 2 of the pods")
 	}
 
-	if err := engine.RemovePodGroup(name); err != nil {
+	if _, err := engine.RemovePodGroup(name); err != nil {
 		t.Errorf("We should be able to remove the pod group, %s", err)
-	} else if err := engine.NewPodGroup(pgSpec); err == nil {
+	} else if _, err := engine.NewPodGroup(pgSpec); err == nil {
 		t.Errorf("We should not be able to deploy pod group again in short time we remove it")
 	}
 
@@ -132,7 +137,7 @@ func initClusterAndStore() (cluster.Cluster, storage.Store, error) {
 		return nil, nil, err
 	}
 
-	c, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, nm, isDebug)
+	c, err := swarm.NewCluster(swarmAddr, 30*time.Second, 10*time.Minute, isDebug)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/mijia/sweb/log"
+)
+
+// probe runs the check against the container once, returns nil if the container passed
+func (s ProbeSpec) probe(c cluster.Cluster, containerId string, containerIp string) error {
+	timeout := s.GetTimeout()
+	switch {
+	case s.HTTPGet != nil:
+		if containerIp == "" {
+			return fmt.Errorf("Container has no ip address")
+		}
+		path := s.HTTPGet.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		client := http.Client{Timeout: timeout}
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", net.JoinHostPort(containerIp, strconv.Itoa(s.HTTPGet.Port)), path))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("HTTP probe got status code %d", resp.StatusCode)
+		}
+		return nil
+	case s.TCPSocket != nil:
+		if containerIp == "" {
+			return fmt.Errorf("Container has no ip address")
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(containerIp, strconv.Itoa(s.TCPSocket.Port)), timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	case s.Exec != nil:
+		// the command is killed inside the container on timeout, the exec returns right after that
+		start := time.Now()
+		exitCode, output, err := c.ExecContainer(containerId, s.Exec.Command, timeout)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			if exitCode == 137 && time.Now().Sub(start) >= timeout {
+				return fmt.Errorf("Exec probe timeout after %s", timeout)
+			}
+			return fmt.Errorf("Exec probe exited with %d, %s", exitCode, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return fmt.Errorf("No probe handler defined")
+}
+
+// refreshHealth runs the health check of the running container if it is time to, and updates the health status
+func (pc *podController) refreshHealth(c cluster.Cluster, container *Container, probe ProbeSpec, startedAt time.Time) {
+	health := &container.Health
+	now := time.Now()
+	if startedAt.After(health.CheckedAt) {
+		// the container has been restarted, forget the old results
+		*health = HealthStatus{}
+	}
+	if now.Before(startedAt.Add(time.Duration(probe.InitialDelay) * time.Second)) {
+		return
+	}
+	if !health.CheckedAt.IsZero() && now.Before(health.CheckedAt.Add(time.Duration(probe.Interval)*time.Second)) {
+		return
+	}
+
+	health.CheckedAt = now
+	if err := probe.probe(c, container.Id, container.ContainerIp); err != nil {
+		log.Warnf("%s health check failed on container %s, %s", pc, container.Id, err)
+		health.Failures += 1
+		health.Successes = 0
+		health.LastError = err.Error()
+		if health.Failures >= probe.GetFailureThreshold() {
+			health.Unhealthy = true
+		}
+	} else {
+		health.Successes += 1
+		health.Failures = 0
+		health.LastError = ""
+		if health.Successes >= probe.GetSuccessThreshold() {
+			health.Unhealthy = false
+		}
+	}
+}
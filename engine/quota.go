@@ -0,0 +1,244 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/sweb/log"
+)
+
+var qtController *quotaController
+
+// QuotaResources is the resources of the pod groups in one namespace, 0 means unlimited in a quota
+type QuotaResources struct {
+	CPUs      int
+	Memory    int64
+	Instances int
+	PodGroups int
+}
+
+func (r QuotaResources) Add(o QuotaResources) QuotaResources {
+	return QuotaResources{
+		CPUs:      r.CPUs + o.CPUs,
+		Memory:    r.Memory + o.Memory,
+		Instances: r.Instances + o.Instances,
+		PodGroups: r.PodGroups + o.PodGroups,
+	}
+}
+
+func (r QuotaResources) Sub(o QuotaResources) QuotaResources {
+	return QuotaResources{
+		CPUs:      r.CPUs - o.CPUs,
+		Memory:    r.Memory - o.Memory,
+		Instances: r.Instances - o.Instances,
+		PodGroups: r.PodGroups - o.PodGroups,
+	}
+}
+
+type QuotaSpec struct {
+	Namespace string
+	Limit     QuotaResources
+}
+
+func (s QuotaSpec) VerifyParams() bool {
+	return s.Namespace != "" && s.Limit.CPUs >= 0 && s.Limit.Memory >= 0 &&
+		s.Limit.Instances >= 0 && s.Limit.PodGroups >= 0
+}
+
+// QuotaUsage is the usage against the limit of the namespace, Limit is empty if there is no quota
+type QuotaUsage struct {
+	Namespace string
+	Limit     QuotaResources
+	Used      QuotaResources
+	HasQuota  bool
+}
+
+// QuotaExceeded is returned when the request would take the namespace over its quota
+type QuotaExceeded struct {
+	QuotaUsage
+	Requested QuotaResources
+	Exceeded  []string
+}
+
+func (qe *QuotaExceeded) Error() string {
+	return fmt.Sprintf("%s, namespace=%s, exceeded=%v, used=%+v, requested=%+v, limit=%+v",
+		ErrQuotaExceeded, qe.Namespace, qe.Exceeded, qe.Used, qe.Requested, qe.Limit)
+}
+
+// checkQuota returns nil if the requested resources can be added, only the increased resources are checked
+// so the request reducing the usage is always allowed.
+func checkQuota(usage QuotaUsage, requested QuotaResources) *QuotaExceeded {
+	if !usage.HasQuota {
+		return nil
+	}
+	var exceeded []string
+	after := usage.Used.Add(requested)
+	limit := usage.Limit
+	if limit.CPUs > 0 && requested.CPUs > 0 && after.CPUs > limit.CPUs {
+		exceeded = append(exceeded, "CPUs")
+	}
+	if limit.Memory > 0 && requested.Memory > 0 && after.Memory > limit.Memory {
+		exceeded = append(exceeded, "Memory")
+	}
+	if limit.Instances > 0 && requested.Instances > 0 && after.Instances > limit.Instances {
+		exceeded = append(exceeded, "Instances")
+	}
+	if limit.PodGroups > 0 && requested.PodGroups > 0 && after.PodGroups > limit.PodGroups {
+		exceeded = append(exceeded, "PodGroups")
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return &QuotaExceeded{usage, requested, exceeded}
+}
+
+// podResources is the reserved resources of one instance
+func podResources(spec PodSpec) (int, int64) {
+	cpus, memory := 0, int64(0)
+	for _, cSpec := range spec.Containers {
+		cpus += cSpec.CpuLimit
+		memory += cSpec.MemoryLimit
+	}
+	return cpus, memory
+}
+
+// podGroupResources counts the instances with the pod spec they should run, the canary ones included.
+// The cron job has no instances itself, its runs are counted as the pod groups of their own.
+// The vacant daemon slots run nothing.
+func podGroupResources(spec PodGroupSpec) QuotaResources {
+	if spec.IsCron() {
+		return QuotaResources{PodGroups: 1}
+	}
+	r := QuotaResources{PodGroups: 1}
+	for i := 1; i <= spec.NumInstances; i += 1 {
+		if spec.IsVacantInstance(i) {
+			continue
+		}
+		r.Instances += 1
+		cpus, memory := podResources(spec.InstancePodSpec(i))
+		r.CPUs += cpus
+		r.Memory += memory
+	}
+	return r
+}
+
+// quotaReservation is the spec of the pod group which has passed the quota check, but is not applied by the
+// queued operation yet
+type quotaReservation struct {
+	seq  int64
+	spec PodGroupSpec
+}
+
+type quotaController struct {
+	sync.RWMutex
+
+	quotas   map[string]QuotaSpec
+	reserved map[string]quotaReservation // pod group name to the reservation
+	seq      int64
+}
+
+func NewQuotaController() *quotaController {
+	return &quotaController{
+		quotas:   make(map[string]QuotaSpec),
+		reserved: make(map[string]quotaReservation),
+	}
+}
+
+func (qc *quotaController) LoadQuotas(store storage.Store) error {
+	quotas := make(map[string]QuotaSpec)
+	quotasKey := fmt.Sprintf("%s/%s", kLainDeploydRootKey, kLainQuotaKey)
+	if keys, err := store.KeysByPrefix(quotasKey); err != nil {
+		if err != storage.ErrNoSuchKey {
+			return err
+		}
+	} else {
+		for _, key := range keys {
+			var quota QuotaSpec
+			if err := store.Get(key, &quota); err != nil {
+				log.Errorf("Failed to load quota %s from storage, %s", key, err)
+				return err
+			}
+			quotas[quota.Namespace] = quota
+			log.Infof("Loaded quota %s from storage, %+v", quota.Namespace, quota.Limit)
+		}
+	}
+	qc.Lock()
+	qc.quotas = quotas
+	qc.Unlock()
+	return nil
+}
+
+func (qc *quotaController) GetQuota(namespace string) (QuotaSpec, bool) {
+	qc.RLock()
+	defer qc.RUnlock()
+	quota, ok := qc.quotas[namespace]
+	return quota, ok
+}
+
+func (qc *quotaController) GetAllQuotas() []QuotaSpec {
+	qc.RLock()
+	defer qc.RUnlock()
+	quotas := make([]QuotaSpec, 0, len(qc.quotas))
+	for _, quota := range qc.quotas {
+		quotas = append(quotas, quota)
+	}
+	sort.Sort(quotasByNamespace(quotas))
+	return quotas
+}
+
+func (qc *quotaController) SetQuota(quota QuotaSpec, store storage.Store) error {
+	qc.Lock()
+	defer qc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainQuotaKey, quota.Namespace)
+	if err := store.Set(key, quota); err != nil {
+		log.Warnf("Failed to set quota key %s, %s", key, err)
+		return err
+	}
+	qc.quotas[quota.Namespace] = quota
+	return nil
+}
+
+// Reserve keeps the spec counted in the usage until the operation applying it releases the reservation
+func (qc *quotaController) Reserve(spec PodGroupSpec) int64 {
+	qc.Lock()
+	defer qc.Unlock()
+	qc.seq += 1
+	qc.reserved[spec.Name] = quotaReservation{qc.seq, spec}
+	return qc.seq
+}
+
+// Release removes the reservation, unless it is replaced by a later one
+func (qc *quotaController) Release(name string, seq int64) {
+	qc.Lock()
+	defer qc.Unlock()
+	if reservation, ok := qc.reserved[name]; ok && reservation.seq == seq {
+		delete(qc.reserved, name)
+	}
+}
+
+func (qc *quotaController) Reserved(name string) (PodGroupSpec, bool) {
+	qc.RLock()
+	defer qc.RUnlock()
+	reservation, ok := qc.reserved[name]
+	return reservation.spec, ok
+}
+
+func (qc *quotaController) RemoveQuota(namespace string, store storage.Store) error {
+	qc.Lock()
+	defer qc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainQuotaKey, namespace)
+	if err := store.Remove(key); err != nil {
+		log.Warnf("Failed to remove quota key %s, %s", key, err)
+		return err
+	}
+	delete(qc.quotas, namespace)
+	return nil
+}
+
+type quotasByNamespace []QuotaSpec
+
+func (q quotasByNamespace) Len() int           { return len(q) }
+func (q quotasByNamespace) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q quotasByNamespace) Less(i, j int) bool { return q[i].Namespace < q[j].Namespace }
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestCheckQuota(t *testing.T) {
+	limited := QuotaUsage{
+		Namespace: "hello",
+		Limit:     QuotaResources{CPUs: 4, Memory: 4000, Instances: 0, PodGroups: 2},
+		Used:      QuotaResources{CPUs: 3, Memory: 3000, Instances: 10, PodGroups: 2},
+		HasQuota:  true,
+	}
+	tests := []struct {
+		usage     QuotaUsage
+		requested QuotaResources
+		exceeded  []string
+	}{
+		{limited, QuotaResources{CPUs: 1, Memory: 1000}, nil},
+		{limited, QuotaResources{CPUs: 2, Memory: 1000}, []string{"CPUs"}},
+		{limited, QuotaResources{CPUs: 2, Memory: 2000, PodGroups: 1}, []string{"CPUs", "Memory", "PodGroups"}},
+		// zero limit means unlimited
+		{limited, QuotaResources{Instances: 100}, nil},
+		// the reductions are always allowed, even if the usage is over the limit
+		{limited, QuotaResources{CPUs: -1, Memory: 500, PodGroups: -1}, nil},
+		{QuotaUsage{
+			Limit:    QuotaResources{CPUs: 1},
+			Used:     QuotaResources{CPUs: 3},
+			HasQuota: true,
+		}, QuotaResources{CPUs: -1}, nil},
+		{QuotaUsage{Used: limited.Used}, QuotaResources{CPUs: 100, PodGroups: 100}, nil},
+	}
+	for i, test := range tests {
+		qe := checkQuota(test.usage, test.requested)
+		if test.exceeded == nil {
+			if qe != nil {
+				t.Errorf("Case %d should be allowed, got %s", i, qe)
+			}
+			continue
+		}
+		if qe == nil {
+			t.Errorf("Case %d should exceed %v, got allowed", i, test.exceeded)
+			continue
+		}
+		if len(qe.Exceeded) != len(test.exceeded) {
+			t.Errorf("Case %d should exceed %v, got %v", i, test.exceeded, qe.Exceeded)
+			continue
+		}
+		for j := range test.exceeded {
+			if qe.Exceeded[j] != test.exceeded[j] {
+				t.Errorf("Case %d should exceed %v, got %v", i, test.exceeded, qe.Exceeded)
+				break
+			}
+		}
+		if qe.Requested != test.requested {
+			t.Errorf("Case %d should report the requested %+v, got %+v", i, test.requested, qe.Requested)
+		}
+	}
+}
+
+func quotaTestPodSpec(cpus int, memory int64) PodSpec {
+	return PodSpec{
+		Containers: []ContainerSpec{
+			{CpuLimit: cpus, MemoryLimit: memory},
+			{CpuLimit: 1, MemoryLimit: 100},
+		},
+	}
+}
+
+func TestPodGroupResources(t *testing.T) {
+	spec := PodGroupSpec{NumInstances: 3, Pod: quotaTestPodSpec(1, 1000)}
+	canary := spec
+	canary.Canary = &CanarySpec{Pod: quotaTestPodSpec(2, 2000), NumInstances: 1}
+	cron := spec
+	cron.Cron = &CronSpec{Schedule: "@daily"}
+	empty := spec
+	empty.NumInstances = 0
+	tests := []struct {
+		spec     PodGroupSpec
+		expected QuotaResources
+	}{
+		{spec, QuotaResources{CPUs: 6, Memory: 3300, Instances: 3, PodGroups: 1}},
+		// the canary instance runs the canary pod spec instead
+		{canary, QuotaResources{CPUs: 7, Memory: 4300, Instances: 3, PodGroups: 1}},
+		// the runs of the cron job are counted by themselves
+		{cron, QuotaResources{PodGroups: 1}},
+		{empty, QuotaResources{PodGroups: 1}},
+	}
+	for i, test := range tests {
+		if r := podGroupResources(test.spec); r != test.expected {
+			t.Errorf("Case %d should be %+v, got %+v", i, test.expected, r)
+		}
+	}
+
+	scaled := spec
+	scaled.NumInstances = 1
+	requested := podGroupResources(scaled).Sub(podGroupResources(spec))
+	if expected := (QuotaResources{CPUs: -4, Memory: -2200, Instances: -2}); requested != expected {
+		t.Errorf("Scaling down should request %+v, got %+v", expected, requested)
+	}
+}
+
+func TestQuotaReservation(t *testing.T) {
+	qc := NewQuotaController()
+	first := qc.Reserve(PodGroupSpec{Name: "hello.web.web", NumInstances: 2})
+	second := qc.Reserve(PodGroupSpec{Name: "hello.web.web", NumInstances: 3})
+	if spec, ok := qc.Reserved("hello.web.web"); !ok || spec.NumInstances != 3 {
+		t.Errorf("Should keep the latest reservation, got %+v", spec)
+	}
+	qc.Release("hello.web.web", first)
+	if _, ok := qc.Reserved("hello.web.web"); !ok {
+		t.Errorf("Should not release the later reservation by the earlier operation")
+	}
+	qc.Release("hello.web.web", second)
+	if _, ok := qc.Reserved("hello.web.web"); ok {
+		t.Errorf("Should release the reservation after the operation")
+	}
+}
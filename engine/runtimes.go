@@ -19,6 +19,9 @@ const (
 	RunStateInconsistent
 	RunStateMissing
 	RunStateRemoved
+	RunStateUnhealthy
+	RunStateCrashLoop
+	RunStateStopped
 )
 
 func (rs RunState) String() string {
@@ -39,6 +42,12 @@ func (rs RunState) String() string {
 		return "RunStateInconsistent"
 	case RunStateRemoved:
 		return "RunStateRemoved"
+	case RunStateUnhealthy:
+		return "RunStateUnhealthy"
+	case RunStateCrashLoop:
+		return "RunStateCrashLoop"
+	case RunStateStopped:
+		return "RunStateStopped"
 	default:
 		return "Unknown RunState"
 	}
@@ -46,9 +55,10 @@ func (rs RunState) String() string {
 
 type ImRuntime struct {
 	BaseRuntime
-	DriftCount   int
-	RestartCount int
-	RestartAt    time.Time
+	DriftCount    int
+	RestartCount  int
+	RestartAt     time.Time
+	NextRestartAt time.Time // the pod will not be restarted before it when backing off
 }
 
 type BaseRuntime struct {
@@ -58,24 +68,54 @@ type BaseRuntime struct {
 }
 
 type Container struct {
-	// FIXME(mijia): multiple ports supporing, will have multiple entries of <NodePort, ContainerPort, Protocol>
-	Id            string
-	Runtime       adoc.ContainerDetail
-	NodeName      string
-	NodeIp        string
-	ContainerIp   string
+	Id          string
+	Runtime     adoc.ContainerDetail
+	NodeName    string
+	NodeIp      string
+	ContainerIp string
+	// NodePort, ContainerPort and Protocol are the same as the first entry of Ports, kept for the old clients
 	NodePort      int
 	ContainerPort int
 	Protocol      string
+	Ports         []ContainerPortBinding
+	Health        HealthStatus
+}
+
+type ContainerPortBinding struct {
+	ContainerPort int
+	NodePort      int
+	Protocol      string
+}
+
+// HealthStatus is the health check result of the container, the counters are reset when the container restarts
+type HealthStatus struct {
+	Unhealthy bool
+	Failures  int
+	Successes int
+	CheckedAt time.Time
+	LastError string
 }
 
 func (c Container) Clone() Container {
 	// So far we maybe only care about the basic information like in the Equals
-	return c
+	n := c
+	if c.Ports != nil {
+		n.Ports = make([]ContainerPortBinding, len(c.Ports))
+		copy(n.Ports, c.Ports)
+	}
+	return n
 }
 
 func (c Container) Equals(o Container) bool {
 	// The ContainerDetail from adoc change would reflect to the Pod runtime changes
+	if len(c.Ports) != len(o.Ports) {
+		return false
+	}
+	for i := range c.Ports {
+		if c.Ports[i] != o.Ports[i] {
+			return false
+		}
+	}
 	return c.Id == o.Id &&
 		c.NodeName == o.NodeName &&
 		c.NodeIp == o.NodeIp &&
@@ -86,8 +126,10 @@ func (c Container) Equals(o Container) bool {
 }
 
 type Pod struct {
-	InstanceNo int
-	Containers []Container
+	InstanceNo     int
+	Version        int
+	Containers     []Container
+	InitContainers []Container
 	ImRuntime
 }
 
@@ -97,6 +139,12 @@ func (p Pod) Clone() Pod {
 	for i := range p.Containers {
 		n.Containers[i] = p.Containers[i].Clone()
 	}
+	if p.InitContainers != nil {
+		n.InitContainers = make([]Container, len(p.InitContainers))
+		for i := range p.InitContainers {
+			n.InitContainers[i] = p.InitContainers[i].Clone()
+		}
+	}
 	return n
 }
 
@@ -126,16 +174,16 @@ func (pod Pod) ContainerIds() []string {
 func (pod Pod) NeedRestart(policy RestartPolicy) bool {
 	state := pod.State
 	if policy == RestartPolicyAlways {
-		return state == RunStateExit || state == RunStateFail
+		return state == RunStateExit || state == RunStateFail || state == RunStateUnhealthy
 	}
 	if policy == RestartPolicyOnFail {
-		return state == RunStateFail
+		return state == RunStateFail || state == RunStateUnhealthy
 	}
 	return false
 }
 
-func (pod Pod) RestartEnoughTimes() bool {
-	return pod.RestartCount >= RestartMaxCount
+func (pod Pod) RestartEnoughTimes(maxCount int) bool {
+	return pod.RestartCount >= maxCount
 }
 
 func (pod Pod) NodeName() string {
@@ -159,8 +207,108 @@ func (pod Pod) PodIp() string {
 	return ""
 }
 
+const (
+	RolloutStateUpgrading  = "upgrading"
+	RolloutStateFinished   = "finished"
+	RolloutStateRolledBack = "rolledback"
+)
+
+// RolloutStatus tracks the per-instance outcomes of the latest spec update
+type RolloutStatus struct {
+	FromVersion int
+	ToVersion   int
+	State       string
+	Upgraded    []int
+	Failed      []int
+	BlockedOn   int // the instance which the rollout is waiting for to be ready
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+func (rs RolloutStatus) Clone() RolloutStatus {
+	n := rs
+	n.Upgraded = make([]int, len(rs.Upgraded))
+	copy(n.Upgraded, rs.Upgraded)
+	n.Failed = make([]int, len(rs.Failed))
+	copy(n.Failed, rs.Failed)
+	return n
+}
+
+const (
+	JobStatePending   = "pending"
+	JobStateRunning   = "running"
+	JobStateSucceeded = "succeeded"
+	JobStateFailed    = "failed"
+)
+
+type JobInstanceStatus struct {
+	InstanceNo int
+	State      string
+	ExitCode   int
+	Attempts   int
+	LastError  string
+}
+
+// JobStatus is the progress of the job pod group, Failed counts the failed runs including the retried ones
+type JobStatus struct {
+	State      string
+	Succeeded  int
+	Failed     int
+	Instances  []JobInstanceStatus
+	Reason     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+func (js JobStatus) Clone() JobStatus {
+	n := js
+	n.Instances = make([]JobInstanceStatus, len(js.Instances))
+	copy(n.Instances, js.Instances)
+	return n
+}
+
+func (js JobStatus) IsFinished() bool {
+	return js.State == JobStateSucceeded || js.State == JobStateFailed
+}
+
+const (
+	CronRunStateSkipped  = "skipped"
+	CronRunStateReplaced = "replaced"
+	CronRunStateRemoved  = "removed"
+)
+
+// CronRun is one run of the cron job, the state is the job state of the run pod group once it is finished,
+// or skipped, replaced and removed.
+type CronRun struct {
+	Name        string
+	Version     int
+	State       string
+	Reason      string
+	ScheduledAt time.Time
+	FinishedAt  time.Time
+}
+
+type CronStatus struct {
+	LastScheduleTime time.Time
+	NextScheduleTime time.Time
+	Active           []CronRun
+	Runs             []CronRun // the finished runs, the latest one last
+}
+
+func (cs CronStatus) Clone() CronStatus {
+	n := cs
+	n.Active = make([]CronRun, len(cs.Active))
+	copy(n.Active, cs.Active)
+	n.Runs = make([]CronRun, len(cs.Runs))
+	copy(n.Runs, cs.Runs)
+	return n
+}
+
 type PodGroup struct {
-	Pods []Pod
+	Pods    []Pod
+	Rollout *RolloutStatus
+	Job     *JobStatus
+	Cron    *CronStatus
 	BaseRuntime
 }
 
@@ -170,6 +318,18 @@ func (pg PodGroup) Clone() PodGroup {
 	for i := range pg.Pods {
 		n.Pods[i] = pg.Pods[i].Clone()
 	}
+	if pg.Rollout != nil {
+		rollout := pg.Rollout.Clone()
+		n.Rollout = &rollout
+	}
+	if pg.Job != nil {
+		job := pg.Job.Clone()
+		n.Job = &job
+	}
+	if pg.Cron != nil {
+		cron := pg.Cron.Clone()
+		n.Cron = &cron
+	}
 	return n
 }
 
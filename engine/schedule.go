@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/scheduler"
+	"github.com/mijia/sweb/log"
+)
+
+// the strategy of the native scheduler, empty means the placement is left to the swarm filters
+var SchedulerStrategy = ""
+
+var podScheduler *scheduler.Scheduler
+
+// parseConstraintFilter parses the swarm filter like "constraint:node!=~node1"
+func parseConstraintFilter(filter string) (scheduler.Constraint, bool) {
+	var c scheduler.Constraint
+	if !strings.HasPrefix(filter, "constraint:") {
+		return c, false
+	}
+	expr := strings.TrimPrefix(filter, "constraint:")
+	for _, operator := range []string{"==", "!="} {
+		if parts := strings.SplitN(expr, operator, 2); len(parts) == 2 {
+			c.Key = parts[0]
+			c.Equal = operator == "=="
+			c.Value = parts[1]
+			if strings.HasPrefix(c.Value, "~") {
+				c.Soft = true
+				c.Value = strings.TrimPrefix(c.Value, "~")
+			}
+			return c, c.Key != ""
+		}
+	}
+	return c, false
+}
+
+// uncheckedFilter finds the hard filter which the native scheduler cannot check, e.g. the pod affinity or
+// the node label constraint, the node pin of the scheduler may conflict with it on swarm
+func uncheckedFilter(filters []string) (string, bool) {
+	for _, filter := range filters {
+		if cst, ok := parseConstraintFilter(filter); ok {
+			if cst.Key != "node" && !cst.Soft {
+				return filter, true
+			}
+		} else if strings.HasPrefix(filter, "affinity:") && !strings.Contains(filter, "=~") {
+			return filter, true
+		}
+	}
+	return "", false
+}
+
+// scheduleRequest collects the placement input of the instance, the filters are the ones passed to swarm
+// and the placements are the number of instances on each node which are known by the caller
+func (pc *podController) scheduleRequest(filters []string, placements map[string]int) scheduler.Request {
+	req := scheduler.Request{
+		Name:       pc.spec.Name,
+		InstanceNo: pc.pod.InstanceNo,
+		Placements: make(map[string]int),
+	}
+	for nodeName, count := range placements {
+		req.Placements[nodeName] = count
+	}
+	req.CPUs, req.Memory = podResources(pc.spec)
+	req.Exclusive = pc.spec.HasHostPorts()
+	if pc.spec.IsStateful() {
+		req.PinnedNode = pc.spec.PrevState.NodeName
+	}
+	if pc.spread.IsEnabled() {
+		req.Domains = topoController.Domains(pc.spread.Key)
+		req.MaxSkew = pc.spread.MaxSkew
+	}
+	for _, filter := range filters {
+		if cst, ok := parseConstraintFilter(filter); ok {
+			req.Constraints = append(req.Constraints, cst)
+		}
+	}
+	return req
+}
+
+// scheduleNode picks the node for the instance, empty node name means swarm should decide.
+// The error is only returned if the topology spread cannot be kept, swarm knows nothing about it.
+func (pc *podController) scheduleNode(c cluster.Cluster, filters []string, placements map[string]int) (string, error) {
+	if podScheduler == nil {
+		if pc.spread.IsEnabled() {
+			log.Warnf("%s Topology spread is ignored without the native scheduler", pc)
+		}
+		return "", nil
+	}
+	if filter, ok := uncheckedFilter(filters); ok {
+		if pc.spread.IsEnabled() {
+			log.Warnf("%s Topology spread is ignored with the filter %s", pc, filter)
+		}
+		log.Infof("%s Leave the instance to swarm, the filter %s cannot be checked by the native scheduler", pc, filter)
+		return "", nil
+	}
+	nodes, err := c.GetResources()
+	if err != nil {
+		log.Warnf("%s Cannot get the cluster resources for scheduling, %s", pc, err)
+		return "", nil
+	}
+	req := pc.scheduleRequest(filters, placements)
+	decision, err := podScheduler.Schedule(nodes, req)
+	if err != nil {
+		if pc.spread.IsEnabled() {
+			return "", fmt.Errorf("%s with topology spread %s<=%d, scores=%+v", err, pc.spread.Key, pc.spread.MaxSkew, decision.Scores)
+		}
+		log.Warnf("%s Cannot schedule the instance, leave it to swarm, %s, scores=%+v", pc, err, decision.Scores)
+		return "", nil
+	}
+	log.Infof("%s scheduled to node %s by %s, scores=%+v", pc, decision.Node, decision.Strategy, decision.Scores)
+	return decision.Node, nil
+}
+
+// placements counts the other instances of the pod group on each node from the pod controllers held by the worker,
+// so no swarm query is needed for every instance deployed. The old instance still holds the host ports when
+// the instance is surged, it is counted only for the exclusive pods.
+func (pgCtrl *podGroupController) placements(pc *podController, others ...*podController) map[string]int {
+	placements := make(map[string]int)
+	for _, podCtrls := range [][]*podController{pgCtrl.podCtrls, others} {
+		for _, podCtrl := range podCtrls {
+			if podCtrl == pc || (podCtrl.pod.InstanceNo == pc.pod.InstanceNo && !pc.spec.HasHostPorts()) {
+				continue
+			}
+			if nodeName := podCtrl.pod.NodeName(); nodeName != "" {
+				placements[nodeName] += 1
+			}
+		}
+	}
+	return placements
+}
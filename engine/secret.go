@@ -0,0 +1,374 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/adoc"
+	"github.com/mijia/sweb/log"
+)
+
+// SecretMasterKey encrypts the secret values before they are saved into the store, the secrets cannot be
+// set or resolved without it
+var SecretMasterKey []byte
+
+const kRedactedValue = "******"
+
+var scrController *secretController
+
+// SecretSpec is the secret set by the api, the values never leave the engine once it is set
+type SecretSpec struct {
+	Namespace string
+	Name      string
+	Data      map[string]string
+}
+
+func (s SecretSpec) VerifyParams() bool {
+	if s.Namespace == "" || s.Name == "" || len(s.Data) == 0 {
+		return false
+	}
+	for key := range s.Data {
+		if key == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// SecretInfo is the secret returned by the api, only the keys are listed
+type SecretInfo struct {
+	Namespace string
+	Name      string
+	Keys      []string
+	Version   int
+	UpdatedAt time.Time
+}
+
+// encryptedSecret is saved into the store, every value is sealed with the key of the secret as the additional data
+type encryptedSecret struct {
+	SecretInfo
+	Data map[string]string
+}
+
+func (s encryptedSecret) Info() SecretInfo {
+	info := s.SecretInfo
+	info.Keys = make([]string, 0, len(s.Data))
+	for key := range s.Data {
+		info.Keys = append(info.Keys, key)
+	}
+	sort.Strings(info.Keys)
+	return info
+}
+
+// SecretEnvSpec sets the env of the container to the value of the secret in the same namespace
+type SecretEnvSpec struct {
+	Env    string
+	Secret string
+	Key    string
+}
+
+func (s SecretEnvSpec) VerifyParams() bool {
+	return s.Env != "" && !strings.Contains(s.Env, "=") && s.Secret != "" && s.Key != ""
+}
+
+// SecretFileSpec writes the value of the secret in the same namespace into the file Path of the container.
+// The file is copied into the container after it is created and before it is started, its mode is 0400 and
+// it is owned by the numeric User of the container, or root if the User is a name.
+type SecretFileSpec struct {
+	Path   string
+	Secret string
+	Key    string
+}
+
+func (s SecretFileSpec) VerifyParams() bool {
+	return path.IsAbs(s.Path) && path.Clean(s.Path) == s.Path && s.Path != "/" && s.Secret != "" && s.Key != ""
+}
+
+func secretAEAD() (cipher.AEAD, error) {
+	if len(SecretMasterKey) == 0 {
+		return nil, ErrSecretKeyMissing
+	}
+	key := sha256.Sum256(SecretMasterKey)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func secretAdditionalData(namespace, name, key string) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s", namespace, name, key))
+}
+
+func encryptSecretValue(aead cipher.AEAD, value string, data []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), data)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecretValue(aead cipher.AEAD, value string, data []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrSecretCorrupted
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, data)
+	if err != nil {
+		return "", ErrSecretCorrupted
+	}
+	return string(plain), nil
+}
+
+type secretController struct {
+	sync.RWMutex
+
+	secrets map[string]encryptedSecret // namespace/name to the secret
+}
+
+func NewSecretController() *secretController {
+	return &secretController{
+		secrets: make(map[string]encryptedSecret),
+	}
+}
+
+func (sc *secretController) LoadSecrets(store storage.Store) error {
+	secrets := make(map[string]encryptedSecret)
+	secretsKey := fmt.Sprintf("%s/%s", kLainDeploydRootKey, kLainSecretKey)
+	if namespaces, err := store.KeysByPrefix(secretsKey); err != nil {
+		if err != storage.ErrNoSuchKey {
+			return err
+		}
+	} else {
+		for _, namespace := range namespaces {
+			keys, err := store.KeysByPrefix(namespace)
+			if err != nil && err != storage.ErrNoSuchKey {
+				return err
+			}
+			for _, key := range keys {
+				var secret encryptedSecret
+				if err := store.Get(key, &secret); err != nil {
+					log.Errorf("Failed to load secret %s from storage, %s", key, err)
+					return err
+				}
+				secrets[secret.Namespace+"/"+secret.Name] = secret
+				log.Infof("Loaded secret %s/%s from storage, version=%d", secret.Namespace, secret.Name, secret.Version)
+			}
+		}
+	}
+	sc.Lock()
+	sc.secrets = secrets
+	sc.Unlock()
+	return nil
+}
+
+// GetSecrets returns the secrets in the namespace, or all the secrets if namespace is empty
+func (sc *secretController) GetSecrets(namespace string) []SecretInfo {
+	sc.RLock()
+	defer sc.RUnlock()
+	infos := make([]SecretInfo, 0, len(sc.secrets))
+	for _, secret := range sc.secrets {
+		if namespace == "" || secret.Namespace == namespace {
+			infos = append(infos, secret.Info())
+		}
+	}
+	sort.Sort(secretsByName(infos))
+	return infos
+}
+
+func (sc *secretController) GetSecret(namespace, name string) (SecretInfo, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	secret, ok := sc.secrets[namespace+"/"+name]
+	return secret.Info(), ok
+}
+
+func (sc *secretController) SetSecret(spec SecretSpec, store storage.Store) error {
+	aead, err := secretAEAD()
+	if err != nil {
+		return err
+	}
+	secret := encryptedSecret{Data: make(map[string]string)}
+	secret.Namespace = spec.Namespace
+	secret.Name = spec.Name
+	secret.UpdatedAt = time.Now()
+	for key, value := range spec.Data {
+		if secret.Data[key], err = encryptSecretValue(aead, value, secretAdditionalData(spec.Namespace, spec.Name, key)); err != nil {
+			return err
+		}
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+	secret.Version = sc.secrets[spec.Namespace+"/"+spec.Name].Version + 1
+	key := fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainSecretKey, spec.Namespace, spec.Name)
+	if err := store.Set(key, secret); err != nil {
+		log.Warnf("Failed to set secret key %s, %s", key, err)
+		return err
+	}
+	sc.secrets[spec.Namespace+"/"+spec.Name] = secret
+	return nil
+}
+
+func (sc *secretController) RemoveSecret(namespace, name string, store storage.Store) error {
+	sc.Lock()
+	defer sc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainSecretKey, namespace, name)
+	if err := store.Remove(key); err != nil {
+		log.Warnf("Failed to remove secret key %s, %s", key, err)
+		return err
+	}
+	store.TryRemoveDir(fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainSecretKey, namespace))
+	delete(sc.secrets, namespace+"/"+name)
+	return nil
+}
+
+// Resolve decrypts the value of the secret, it should only be called when the container is created
+func (sc *secretController) Resolve(namespace, name, key string) (string, error) {
+	sc.RLock()
+	secret, ok := sc.secrets[namespace+"/"+name]
+	sc.RUnlock()
+	if !ok {
+		return "", ErrSecretNotExists
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", ErrSecretNotExists
+	}
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	return decryptSecretValue(aead, value, secretAdditionalData(namespace, name, key))
+}
+
+// secretEnvs resolves the secret envs of the container
+func secretEnvs(namespace string, spec ContainerSpec) ([]string, error) {
+	envs := make([]string, 0, len(spec.SecretEnv))
+	for _, se := range spec.SecretEnv {
+		value, err := scrController.Resolve(namespace, se.Secret, se.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot resolve the secret %s/%s for env %s, %s", se.Secret, se.Key, se.Env, err)
+		}
+		envs = append(envs, fmt.Sprintf("%s=%s", se.Env, value))
+	}
+	return envs, nil
+}
+
+// secretFilesArchive resolves the secret files of the container into a tar archive which is extracted at "/"
+func secretFilesArchive(namespace string, spec ContainerSpec) ([]byte, error) {
+	uid, gid := containerOwner(spec.User)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for _, sf := range spec.SecretFiles {
+		value, err := scrController.Resolve(namespace, sf.Secret, sf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot resolve the secret %s/%s for file %s, %s", sf.Secret, sf.Key, sf.Path, err)
+		}
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(sf.Path, "/"),
+			Mode:    0400,
+			Uid:     uid,
+			Gid:     gid,
+			Size:    int64(len(value)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// containerOwner returns the uid and gid of the numeric user like "1000" or "1000:1000", root for the others
+func containerOwner(user string) (int, int) {
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil || uid < 0 {
+		return 0, 0
+	}
+	gid := uid
+	if len(parts) == 2 {
+		if gid, err = strconv.Atoi(parts[1]); err != nil || gid < 0 {
+			gid = 0
+		}
+	}
+	return uid, gid
+}
+
+// redactSecretEnvs hides the secret values in the inspected container, the runtime is saved and returned by the api
+func redactSecretEnvs(info *adoc.ContainerDetail, spec ContainerSpec) {
+	if len(spec.SecretEnv) == 0 {
+		return
+	}
+	env := make([]string, len(info.Config.Env))
+	for i, e := range info.Config.Env {
+		env[i] = e
+		for _, se := range spec.SecretEnv {
+			if strings.HasPrefix(e, se.Env+"=") {
+				env[i] = se.Env + "=" + kRedactedValue
+				break
+			}
+		}
+	}
+	info.Config.Env = env
+}
+
+// podSpecUsesSecret checks whether the containers of the pod reference the secret
+func podSpecUsesSecret(spec PodSpec, namespace, name string) bool {
+	if spec.Namespace != namespace {
+		return false
+	}
+	for _, containers := range [][]ContainerSpec{spec.InitContainers, spec.Containers} {
+		for _, cSpec := range containers {
+			for _, se := range cSpec.SecretEnv {
+				if se.Secret == name {
+					return true
+				}
+			}
+			for _, sf := range cSpec.SecretFiles {
+				if sf.Secret == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type secretsByName []SecretInfo
+
+func (s secretsByName) Len() int      { return len(s) }
+func (s secretsByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s secretsByName) Less(i, j int) bool {
+	if s[i].Namespace != s[j].Namespace {
+		return s[i].Namespace < s[j].Namespace
+	}
+	return s[i].Name < s[j].Name
+}
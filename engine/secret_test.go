@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mijia/adoc"
+)
+
+// withSecretMasterKey sets the master key and returns the func to restore the old one
+func withSecretMasterKey(key string) func() {
+	old := SecretMasterKey
+	SecretMasterKey = []byte(key)
+	return func() { SecretMasterKey = old }
+}
+
+func TestSecretValueRoundTrip(t *testing.T) {
+	defer withSecretMasterKey("master")()
+	aead, err := secretAEAD()
+	if err != nil {
+		t.Fatalf("Cannot create the cipher, %s", err)
+	}
+	data := secretAdditionalData("hello", "mysql", "password")
+	for _, value := range []string{"", "s3cret", "with\nnew line and 中文"} {
+		sealed, err := encryptSecretValue(aead, value, data)
+		if err != nil {
+			t.Fatalf("Cannot encrypt %q, %s", value, err)
+		}
+		if value != "" && bytes.Contains([]byte(sealed), []byte(value)) {
+			t.Errorf("Encrypted value should not contain the plain text, got %s", sealed)
+		}
+		plain, err := decryptSecretValue(aead, sealed, data)
+		if err != nil || plain != value {
+			t.Errorf("Should decrypt %q, got %q, %v", value, plain, err)
+		}
+	}
+
+	first, _ := encryptSecretValue(aead, "s3cret", data)
+	second, _ := encryptSecretValue(aead, "s3cret", data)
+	if first == second {
+		t.Errorf("Same value should be encrypted with different nonces")
+	}
+}
+
+func TestSecretValueWrongAdditionalData(t *testing.T) {
+	defer withSecretMasterKey("master")()
+	aead, _ := secretAEAD()
+	sealed, err := encryptSecretValue(aead, "s3cret", secretAdditionalData("hello", "mysql", "password"))
+	if err != nil {
+		t.Fatalf("Cannot encrypt, %s", err)
+	}
+	// the value cannot be moved to another key, secret or namespace
+	for _, data := range [][]byte{
+		secretAdditionalData("hello", "mysql", "user"),
+		secretAdditionalData("hello", "redis", "password"),
+		secretAdditionalData("other", "mysql", "password"),
+	} {
+		if _, err := decryptSecretValue(aead, sealed, data); err != ErrSecretCorrupted {
+			t.Errorf("Should not decrypt with %s, got %v", data, err)
+		}
+	}
+
+	defer withSecretMasterKey("another master")()
+	other, _ := secretAEAD()
+	if _, err := decryptSecretValue(other, sealed, secretAdditionalData("hello", "mysql", "password")); err != ErrSecretCorrupted {
+		t.Errorf("Should not decrypt with another master key, got %v", err)
+	}
+	if _, err := decryptSecretValue(other, "c2hvcnQ=", nil); err != ErrSecretCorrupted {
+		t.Errorf("Should not decrypt the truncated value, got %v", err)
+	}
+}
+
+func TestSecretMasterKeyMissing(t *testing.T) {
+	defer withSecretMasterKey("")()
+	if _, err := secretAEAD(); err != ErrSecretKeyMissing {
+		t.Errorf("Should require the master key, got %v", err)
+	}
+}
+
+func TestRedactSecretEnvs(t *testing.T) {
+	var info adoc.ContainerDetail
+	info.Config.Env = []string{"MYSQL_PASSWORD=s3cret", "MYSQL_PASSWORD_FILE=/run/secrets/x", "MYSQL_USER=root", "TOKEN="}
+	env := info.Config.Env
+	spec := ContainerSpec{SecretEnv: []SecretEnvSpec{
+		{Env: "MYSQL_PASSWORD", Secret: "mysql", Key: "password"},
+		{Env: "TOKEN", Secret: "api", Key: "token"},
+	}}
+	redactSecretEnvs(&info, spec)
+	expected := []string{"MYSQL_PASSWORD=******", "MYSQL_PASSWORD_FILE=/run/secrets/x", "MYSQL_USER=root", "TOKEN=******"}
+	for i := range expected {
+		if info.Config.Env[i] != expected[i] {
+			t.Errorf("Env %d should be %q, got %q", i, expected[i], info.Config.Env[i])
+		}
+	}
+	if env[0] != "MYSQL_PASSWORD=s3cret" {
+		t.Errorf("Should not change the env slice of the inspected container in place, got %q", env[0])
+	}
+}
+
+func TestSecretFilesArchive(t *testing.T) {
+	defer withSecretMasterKey("master")()
+	old := scrController
+	scrController = NewSecretController()
+	defer func() { scrController = old }()
+	spec := SecretSpec{Namespace: "hello", Name: "mysql", Data: map[string]string{"password": "s3cret"}}
+	if err := scrController.SetSecret(spec, newMemStore()); err != nil {
+		t.Fatalf("Cannot set the secret, %s", err)
+	}
+
+	cSpec := ContainerSpec{
+		User:        "1000:2000",
+		SecretFiles: []SecretFileSpec{{Path: "/run/secrets/mysql-password", Secret: "mysql", Key: "password"}},
+	}
+	archive, err := secretFilesArchive("hello", cSpec)
+	if err != nil {
+		t.Fatalf("Cannot create the archive, %s", err)
+	}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("Cannot read the archive, %s", err)
+	}
+	if header.Name != "run/secrets/mysql-password" || header.Mode != 0400 || header.Uid != 1000 || header.Gid != 2000 {
+		t.Errorf("Secret file header is wrong, got %+v", header)
+	}
+	if content, _ := ioutil.ReadAll(tr); string(content) != "s3cret" {
+		t.Errorf("Secret file should have the value, got %q", content)
+	}
+
+	if _, err := secretFilesArchive("other", cSpec); err == nil {
+		t.Errorf("Should not resolve the secret in another namespace")
+	}
+}
+
+func TestContainerOwner(t *testing.T) {
+	tests := []struct {
+		user     string
+		uid, gid int
+	}{
+		{"", 0, 0},
+		{"nobody", 0, 0},
+		{"1000", 1000, 1000},
+		{"1000:50", 1000, 50},
+		{"1000:staff", 1000, 0},
+	}
+	for _, test := range tests {
+		if uid, gid := containerOwner(test.user); uid != test.uid || gid != test.gid {
+			t.Errorf("Owner of %q should be %d:%d, got %d:%d", test.user, test.uid, test.gid, uid, gid)
+		}
+	}
+}
+
+func TestSecretFileVerifyParams(t *testing.T) {
+	tests := []struct {
+		spec  SecretFileSpec
+		valid bool
+	}{
+		{SecretFileSpec{Path: "/run/secrets/a", Secret: "s", Key: "k"}, true},
+		{SecretFileSpec{Path: "run/secrets/a", Secret: "s", Key: "k"}, false},
+		{SecretFileSpec{Path: "/run/../etc/passwd", Secret: "s", Key: "k"}, false},
+		{SecretFileSpec{Path: "/", Secret: "s", Key: "k"}, false},
+		{SecretFileSpec{Path: "/run/secrets/a", Key: "k"}, false},
+	}
+	for i, test := range tests {
+		if valid := test.spec.VerifyParams(); valid != test.valid {
+			t.Errorf("Case %d should be %v, got %v", i, test.valid, valid)
+		}
+	}
+}
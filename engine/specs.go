@@ -3,21 +3,29 @@ package engine
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/laincloud/deployd/utils/cron"
 	"github.com/mijia/adoc"
 	"github.com/mijia/go-generics"
 )
 
 const (
-	kLainDeploydRootKey = "/lain/deployd"
-	kLainConstraintKey  = "constraints"
-	kLainNotifyKey      = "notifies"
-	kLainPodGroupKey    = "pod_groups"
-	kLainDependencyKey  = "depends"
-	kLainSpecKey        = "specs"
-	kLainPodKey         = "pods"
-	kLainNodesKey       = "nodes"
+	kLainDeploydRootKey   = "/lain/deployd"
+	kLainConstraintKey    = "constraints"
+	kLainNotifyKey        = "notifies"
+	kLainPodGroupKey      = "pod_groups"
+	kLainDependencyKey    = "depends"
+	kLainSpecKey          = "specs"
+	kLainPodKey           = "pods"
+	kLainNodesKey         = "nodes"
+	kLainQuotaKey         = "quotas"
+	kLainRevisionKey      = "revisions"
+	kLainVolumeKey        = "volumes"
+	kLainSecretKey        = "secrets"
+	kLainConfigKey        = "configs"
+	kLainConfigVersionKey = "config_versions"
 
 	kLainVolumeRoot      = "/data/lain/volumes"
 	kLainCloudVolumeRoot = "/data/lain/cloud-volumes"
@@ -28,6 +36,18 @@ const (
 
 	MinPodKillTimeout = 10
 	MaxPodKillTimeout = 120
+
+	kDefaultProbeTimeout          = 1
+	kDefaultProbeFailureThreshold = 3
+	kDefaultReadinessDeadline     = 300
+
+	kDefaultRestartBackoffMultiplier = 2
+
+	kDefaultRemoveDelay = 10
+
+	kDefaultInitTimeout = 600
+
+	kMaxHostnameLength = 63
 )
 
 type ImSpec struct {
@@ -49,7 +69,7 @@ type ContainerLabel struct {
 }
 
 func (label ContainerLabel) NameAffinity() string {
-	return fmt.Sprintf("affinity:%s.pg_name!=~%s", kLainLabelPrefix, label.Name)
+	return PodAffinity{Scope: AffinityScopePodGroup, Value: label.Name, Anti: true}.Filter()
 }
 
 func (label ContainerLabel) Label2Maps() map[string]string {
@@ -111,37 +131,206 @@ func (s CloudVolumeSpec) Equals(o CloudVolumeSpec) bool {
 		generics.Equal_StringSlice(s.Dirs, o.Dirs)
 }
 
+const (
+	PortProtocolTCP = "tcp"
+	PortProtocolUDP = "udp"
+)
+
+// PortSpec is a port exposed by the container, HostPort is a random port on the node if it's 0
+type PortSpec struct {
+	ContainerPort int
+	Protocol      string
+	HostPort      int
+}
+
+func (s PortSpec) VerifyParams() bool {
+	return s.ContainerPort > 0 &&
+		s.HostPort >= 0 &&
+		(s.Protocol == "" || s.Protocol == PortProtocolTCP || s.Protocol == PortProtocolUDP)
+}
+
+func (s PortSpec) GetProtocol() string {
+	if s.Protocol == "" {
+		return PortProtocolTCP
+	}
+	return s.Protocol
+}
+
+// DockerPort returns the port in docker's format, e.g. 8080/tcp
+func (s PortSpec) DockerPort() string {
+	return fmt.Sprintf("%d/%s", s.ContainerPort, s.GetProtocol())
+}
+
+type HTTPGetProbe struct {
+	Path string
+	Port int
+}
+
+type TCPSocketProbe struct {
+	Port int
+}
+
+type ExecProbe struct {
+	Command []string
+}
+
+// ProbeSpec checks whether the container works well, only one of HTTPGet, TCPSocket and Exec should be set.
+// Interval, Timeout and InitialDelay are in seconds. The health checks run with the refresh of the pod group,
+// so the effective Interval of a HealthCheck is never shorter than RefreshInterval.
+type ProbeSpec struct {
+	HTTPGet          *HTTPGetProbe
+	TCPSocket        *TCPSocketProbe
+	Exec             *ExecProbe
+	InitialDelay     int
+	Interval         int
+	Timeout          int
+	FailureThreshold int
+	SuccessThreshold int
+}
+
+func (s ProbeSpec) Clone() ProbeSpec {
+	newSpec := s
+	if s.HTTPGet != nil {
+		httpGet := *s.HTTPGet
+		newSpec.HTTPGet = &httpGet
+	}
+	if s.TCPSocket != nil {
+		tcpSocket := *s.TCPSocket
+		newSpec.TCPSocket = &tcpSocket
+	}
+	if s.Exec != nil {
+		newSpec.Exec = &ExecProbe{generics.Clone_StringSlice(s.Exec.Command)}
+	}
+	return newSpec
+}
+
+func (s ProbeSpec) VerifyParams() bool {
+	handlers := 0
+	if s.HTTPGet != nil {
+		if s.HTTPGet.Port <= 0 {
+			return false
+		}
+		handlers += 1
+	}
+	if s.TCPSocket != nil {
+		if s.TCPSocket.Port <= 0 {
+			return false
+		}
+		handlers += 1
+	}
+	if s.Exec != nil {
+		if len(s.Exec.Command) == 0 {
+			return false
+		}
+		handlers += 1
+	}
+	return handlers == 1 &&
+		s.InitialDelay >= 0 &&
+		s.Interval >= 0 &&
+		s.Timeout >= 0 &&
+		s.FailureThreshold >= 0 &&
+		s.SuccessThreshold >= 0
+}
+
+func (s ProbeSpec) Equals(o ProbeSpec) bool {
+	if (s.HTTPGet == nil) != (o.HTTPGet == nil) ||
+		(s.TCPSocket == nil) != (o.TCPSocket == nil) ||
+		(s.Exec == nil) != (o.Exec == nil) {
+		return false
+	}
+	if s.HTTPGet != nil && *s.HTTPGet != *o.HTTPGet {
+		return false
+	}
+	if s.TCPSocket != nil && *s.TCPSocket != *o.TCPSocket {
+		return false
+	}
+	if s.Exec != nil && !generics.Equal_StringSlice(s.Exec.Command, o.Exec.Command) {
+		return false
+	}
+	return s.InitialDelay == o.InitialDelay &&
+		s.Interval == o.Interval &&
+		s.Timeout == o.Timeout &&
+		s.FailureThreshold == o.FailureThreshold &&
+		s.SuccessThreshold == o.SuccessThreshold
+}
+
+func (s ProbeSpec) GetTimeout() time.Duration {
+	if s.Timeout <= 0 {
+		return time.Duration(kDefaultProbeTimeout) * time.Second
+	}
+	return time.Duration(s.Timeout) * time.Second
+}
+
+func (s ProbeSpec) GetFailureThreshold() int {
+	if s.FailureThreshold <= 0 {
+		return kDefaultProbeFailureThreshold
+	}
+	return s.FailureThreshold
+}
+
+func (s ProbeSpec) GetSuccessThreshold() int {
+	if s.SuccessThreshold <= 0 {
+		return 1
+	}
+	return s.SuccessThreshold
+}
+
 type ContainerSpec struct {
 	ImSpec
 	Image         string
 	Env           []string
+	SecretEnv     []SecretEnvSpec // resolved only when the container is created, never saved in plain text
+	SecretFiles   []SecretFileSpec
 	User          string
 	WorkingDir    string
 	DnsSearch     []string
 	Volumes       []string // a stateful flag
 	SystemVolumes []string // not a stateful flag, every node has system volumes
+	Configs       []ConfigMountSpec
 	CloudVolumes  []CloudVolumeSpec
 	Command       []string
 	Entrypoint    []string
 	CpuLimit      int
 	MemoryLimit   int64
-	Expose        int
+	Expose        int // deprecated, the same as a tcp port in Ports
+	Ports         []PortSpec
 	LogConfig     adoc.LogConfig
+	HealthCheck   *ProbeSpec
 }
 
 func (s ContainerSpec) Clone() ContainerSpec {
 	newSpec := s
 	newSpec.Env = generics.Clone_StringSlice(s.Env)
+	if s.SecretEnv != nil {
+		newSpec.SecretEnv = make([]SecretEnvSpec, len(s.SecretEnv))
+		copy(newSpec.SecretEnv, s.SecretEnv)
+	}
+	if s.SecretFiles != nil {
+		newSpec.SecretFiles = make([]SecretFileSpec, len(s.SecretFiles))
+		copy(newSpec.SecretFiles, s.SecretFiles)
+	}
+	if s.Configs != nil {
+		newSpec.Configs = make([]ConfigMountSpec, len(s.Configs))
+		copy(newSpec.Configs, s.Configs)
+	}
 	newSpec.Volumes = generics.Clone_StringSlice(s.Volumes)
 	newSpec.SystemVolumes = generics.Clone_StringSlice(s.SystemVolumes)
 	newSpec.Command = generics.Clone_StringSlice(s.Command)
 	newSpec.DnsSearch = generics.Clone_StringSlice(s.DnsSearch)
 	newSpec.Entrypoint = generics.Clone_StringSlice(s.Entrypoint)
+	if s.Ports != nil {
+		newSpec.Ports = make([]PortSpec, len(s.Ports))
+		copy(newSpec.Ports, s.Ports)
+	}
 	newSpec.LogConfig.Type = s.LogConfig.Type
 	newSpec.LogConfig.Config = generics.Clone_StringStringMap(s.LogConfig.Config)
 	for i := range s.CloudVolumes {
 		newSpec.CloudVolumes[i] = s.CloudVolumes[i].Clone()
 	}
+	if s.HealthCheck != nil {
+		healthCheck := s.HealthCheck.Clone()
+		newSpec.HealthCheck = &healthCheck
+	}
 	return newSpec
 }
 
@@ -158,6 +347,33 @@ func (s ContainerSpec) VerifyParams() bool {
 			return false
 		}
 	}
+	exposed := make(map[string]bool)
+	for _, port := range s.Ports {
+		if !port.VerifyParams() || exposed[port.DockerPort()] {
+			return false
+		}
+		exposed[port.DockerPort()] = true
+	}
+	for _, se := range s.SecretEnv {
+		if !se.VerifyParams() {
+			return false
+		}
+	}
+	files := make(map[string]bool)
+	for _, sf := range s.SecretFiles {
+		if !sf.VerifyParams() || files[sf.Path] {
+			return false
+		}
+		files[sf.Path] = true
+	}
+	for _, mount := range s.Configs {
+		if !mount.VerifyParams() {
+			return false
+		}
+	}
+	if s.HealthCheck != nil && !s.HealthCheck.VerifyParams() {
+		return false
+	}
 	return true
 }
 
@@ -165,18 +381,91 @@ func (s ContainerSpec) Equals(o ContainerSpec) bool {
 	return s.Name == o.Name &&
 		s.Image == o.Image &&
 		generics.Equal_StringSlice(s.Env, o.Env) &&
+		equalSecretEnvs(s.SecretEnv, o.SecretEnv) &&
+		equalSecretFiles(s.SecretFiles, o.SecretFiles) &&
+		equalConfigMounts(s.Configs, o.Configs) &&
 		generics.Equal_StringSlice(s.Command, o.Command) &&
 		generics.Equal_StringSlice(s.DnsSearch, o.DnsSearch) &&
 		s.CpuLimit == o.CpuLimit &&
 		s.MemoryLimit == o.MemoryLimit &&
 		s.Expose == o.Expose &&
+		equalPorts(s.Ports, o.Ports) &&
 		s.User == o.User &&
 		s.WorkingDir == o.WorkingDir &&
 		generics.Equal_StringSlice(s.Volumes, o.Volumes) &&
 		generics.Equal_StringSlice(s.SystemVolumes, o.SystemVolumes) &&
 		generics.Equal_StringSlice(s.Entrypoint, o.Entrypoint) &&
 		s.LogConfig.Type == o.LogConfig.Type &&
-		generics.Equal_StringStringMap(s.LogConfig.Config, o.LogConfig.Config)
+		generics.Equal_StringStringMap(s.LogConfig.Config, o.LogConfig.Config) &&
+		((s.HealthCheck == nil && o.HealthCheck == nil) ||
+			(s.HealthCheck != nil && o.HealthCheck != nil && s.HealthCheck.Equals(*o.HealthCheck)))
+}
+
+// GetPorts returns all the exposed ports, including the deprecated Expose
+func (s ContainerSpec) GetPorts() []PortSpec {
+	ports := make([]PortSpec, 0, len(s.Ports)+1)
+	if s.Expose > 0 {
+		exposed := PortSpec{ContainerPort: s.Expose, Protocol: PortProtocolTCP}
+		found := false
+		for _, port := range s.Ports {
+			if port.DockerPort() == exposed.DockerPort() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ports = append(ports, exposed)
+		}
+	}
+	return append(ports, s.Ports...)
+}
+
+func equalPorts(s, o []PortSpec) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSecretEnvs(s, o []SecretEnvSpec) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSecretFiles(s, o []SecretFileSpec) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalConfigMounts(s, o []ConfigMountSpec) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func NewContainerSpec(image string) ContainerSpec {
@@ -228,13 +517,24 @@ type PodSpec struct {
 	ImSpec
 	Network      string
 	Containers   []ContainerSpec
-	Filters      []string // for cluster scheduling
+	Filters      []string // for cluster scheduling, cleared after the deployment
+	Affinity     AffinitySpec
 	Dependencies []Dependency
 	Annotation   string
 	Stateful     bool
 	SetupTime    int
 	KillTimeout  int
 	PrevState    PodPrevState
+
+	// Readiness is checked against the first container, the spec update waits for it before moving on,
+	// up to ReadinessDeadline seconds. SetupTime is used instead if there is no readiness probe.
+	Readiness         *ProbeSpec
+	ReadinessDeadline int
+
+	// InitContainers run one by one before the containers are created, every one should exit 0 in InitTimeout seconds.
+	// They share the volumes of the first container.
+	InitContainers []ContainerSpec
+	InitTimeout    int
 }
 
 func (s PodSpec) GetSetupTime() int {
@@ -255,6 +555,20 @@ func (s PodSpec) GetKillTimeout() int {
 	return s.KillTimeout
 }
 
+func (s PodSpec) GetReadinessDeadline() time.Duration {
+	if s.ReadinessDeadline <= 0 {
+		return time.Duration(kDefaultReadinessDeadline) * time.Second
+	}
+	return time.Duration(s.ReadinessDeadline) * time.Second
+}
+
+func (s PodSpec) GetInitTimeout() time.Duration {
+	if s.InitTimeout <= 0 {
+		return time.Duration(kDefaultInitTimeout) * time.Second
+	}
+	return time.Duration(s.InitTimeout) * time.Second
+}
+
 func (s PodSpec) String() string {
 	return fmt.Sprintf("Pod[name=%s, version=%d, depends=%+v, stateful=%v, #containers=%d]",
 		s.Name, s.Version, s.Dependencies, s.Stateful, len(s.Containers))
@@ -263,6 +577,7 @@ func (s PodSpec) String() string {
 func (s PodSpec) Clone() PodSpec {
 	newSpec := s
 	newSpec.Filters = generics.Clone_StringSlice(s.Filters)
+	newSpec.Affinity = s.Affinity.Clone()
 	newSpec.Containers = make([]ContainerSpec, len(s.Containers))
 	newSpec.PrevState = s.PrevState.Clone()
 	for i := range s.Containers {
@@ -272,6 +587,16 @@ func (s PodSpec) Clone() PodSpec {
 	for i := range s.Dependencies {
 		newSpec.Dependencies[i] = s.Dependencies[i].Clone()
 	}
+	if s.Readiness != nil {
+		readiness := s.Readiness.Clone()
+		newSpec.Readiness = &readiness
+	}
+	if s.InitContainers != nil {
+		newSpec.InitContainers = make([]ContainerSpec, len(s.InitContainers))
+		for i := range s.InitContainers {
+			newSpec.InitContainers[i] = s.InitContainers[i].Clone()
+		}
+	}
 	return newSpec
 }
 
@@ -281,12 +606,48 @@ func (s PodSpec) VerifyParams() bool {
 	if !verify {
 		return false
 	}
+	// the containers of the pod are on the same node, they cannot bind the same host port
+	hostPorts := make(map[string]bool)
 	for _, cSpec := range s.Containers {
 		if !cSpec.VerifyParams() {
 			return false
 		}
+		for _, port := range cSpec.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+			hostPort := fmt.Sprintf("%d/%s", port.HostPort, port.GetProtocol())
+			if hostPorts[hostPort] {
+				return false
+			}
+			hostPorts[hostPort] = true
+		}
 	}
-	return true
+	for _, cSpec := range s.InitContainers {
+		if !cSpec.VerifyParams() {
+			return false
+		}
+	}
+	if s.Readiness != nil && !s.Readiness.VerifyParams() {
+		return false
+	}
+	if !s.Affinity.VerifyParams() {
+		return false
+	}
+	return s.ReadinessDeadline >= 0 && s.InitTimeout >= 0
+}
+
+// HasHostPorts checks whether the pod binds fixed host ports, only one instance of the pod group
+// can be placed on a node then
+func (s PodSpec) HasHostPorts() bool {
+	for _, cSpec := range s.Containers {
+		for _, port := range cSpec.Ports {
+			if port.HostPort > 0 {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (s PodSpec) IsHardStateful() bool {
@@ -315,6 +676,14 @@ func (s PodSpec) Equals(o PodSpec) bool {
 			return false
 		}
 	}
+	if len(s.InitContainers) != len(o.InitContainers) {
+		return false
+	}
+	for i := range s.InitContainers {
+		if !s.InitContainers[i].Equals(o.InitContainers[i]) {
+			return false
+		}
+	}
 	if len(s.Dependencies) != len(o.Dependencies) {
 		return false
 	}
@@ -328,15 +697,25 @@ func (s PodSpec) Equals(o PodSpec) bool {
 		s.Version == o.Version &&
 		s.Annotation == o.Annotation &&
 		s.Stateful == o.Stateful &&
-		generics.Equal_StringSlice(s.Filters, o.Filters)
+		generics.Equal_StringSlice(s.Filters, o.Filters) &&
+		s.Affinity.Equals(o.Affinity) &&
+		s.ReadinessDeadline == o.ReadinessDeadline &&
+		s.InitTimeout == o.InitTimeout &&
+		((s.Readiness == nil && o.Readiness == nil) ||
+			(s.Readiness != nil && o.Readiness != nil && s.Readiness.Equals(*o.Readiness)))
 }
 
 func (s PodSpec) Merge(o PodSpec) PodSpec {
 	s.Containers = o.Containers
 	s.Dependencies = o.Dependencies
 	s.Filters = o.Filters
+	s.Affinity = o.Affinity
 	s.Annotation = o.Annotation
 	s.Stateful = o.Stateful
+	s.Readiness = o.Readiness
+	s.ReadinessDeadline = o.ReadinessDeadline
+	s.InitContainers = o.InitContainers
+	s.InitTimeout = o.InitTimeout
 	s.Version += 1
 	s.UpdatedAt = time.Now()
 	s.PrevState = o.PrevState
@@ -413,11 +792,257 @@ func (pgps PodGroupPrevState) Length() int {
 	return len(pgps.Nodes)
 }
 
+// RollingUpdateStrategy controls how the instances are replaced when the pod spec is updated,
+// MaxSurge is how many new instances can be deployed beside the old ones, and MaxUnavailable
+// is how many old instances can be removed before their replacements are running.
+// MaxFailedInstances is how many instances can fail to come up before the update is rolled back.
+// RemoveDelay is the seconds to wait between removing an old instance and deploying its replacement
+// in place, e.g. for the node to release the old ip, 0 means the default 10 seconds and -1 deploys it at once.
+type RollingUpdateStrategy struct {
+	MaxSurge           int
+	MaxUnavailable     int
+	MaxFailedInstances int
+	RemoveDelay        int
+}
+
+func (s RollingUpdateStrategy) VerifyParams() bool {
+	return s.MaxSurge >= 0 && s.MaxUnavailable >= 0 && s.MaxFailedInstances >= 0 && s.RemoveDelay >= -1
+}
+
+// GetRemoveDelay returns the seconds to wait before the in place replacement is deployed
+func (s RollingUpdateStrategy) GetRemoveDelay() int {
+	switch {
+	case s.RemoveDelay < 0:
+		return 0
+	case s.RemoveDelay == 0:
+		return kDefaultRemoveDelay
+	}
+	return s.RemoveDelay
+}
+
+// RolloutBatch returns the surge and unavailable numbers of the rolling upgrade from oldPodSpec to newPodSpec,
+// the stateful instances never surge and the ordered pod group is upgraded one by one
+func (spec PodGroupSpec) RolloutBatch(numInstances int, oldPodSpec, newPodSpec PodSpec) (int, int) {
+	surge, unavailable := spec.RollingUpdate.Normalize(numInstances)
+	if oldPodSpec.IsStateful() || newPodSpec.IsStateful() {
+		// stateful instances are bound to their volumes and nodes, cannot run two copies at the same time
+		surge = 0
+		if unavailable == 0 {
+			unavailable = 1
+		}
+	}
+	if spec.Ordered {
+		// one by one, the next instance is upgraded after the former one is ready
+		surge, unavailable = 0, 1
+	}
+	return surge, unavailable
+}
+
+// FailureThreshold returns the number of failed instances which halts the update, at least 1
+func (s RollingUpdateStrategy) FailureThreshold() int {
+	if s.MaxFailedInstances <= 0 {
+		return 1
+	}
+	return s.MaxFailedInstances
+}
+
+// Normalize returns the effective surge and unavailable numbers for the given instance count,
+// the zero strategy keeps the original one by one remove-then-deploy behavior.
+func (s RollingUpdateStrategy) Normalize(numInstances int) (int, int) {
+	surge, unavailable := s.MaxSurge, s.MaxUnavailable
+	if surge < 0 {
+		surge = 0
+	}
+	if unavailable < 0 {
+		unavailable = 0
+	}
+	if surge == 0 && unavailable == 0 {
+		unavailable = 1
+	}
+	if surge > numInstances {
+		surge = numInstances
+	}
+	if unavailable > numInstances {
+		unavailable = numInstances
+	}
+	return surge, unavailable
+}
+
+// PodGroupRevision is a history pod spec of the pod group, the Revision is the PodGroupSpec version
+type PodGroupRevision struct {
+	Revision  int
+	Pod       PodSpec
+	CreatedAt time.Time
+}
+
+// CanarySpec is a new pod spec running on the first NumInstances instances beside the current version,
+// until it is promoted to the whole pod group or aborted.
+type CanarySpec struct {
+	Pod          PodSpec
+	NumInstances int
+}
+
+func (c CanarySpec) Clone() CanarySpec {
+	newCanary := c
+	newCanary.Pod = c.Pod.Clone()
+	return newCanary
+}
+
+func (c CanarySpec) Equals(o CanarySpec) bool {
+	return c.NumInstances == o.NumInstances &&
+		c.Pod.Equals(o.Pod)
+}
+
+// RestartBackoff delays the restarts of a down pod, the delay starts from Initial seconds and is multiplied
+// by Multiplier after every restart, up to Max seconds. The zero value restarts the pod on every refresh.
+type RestartBackoff struct {
+	Initial    int
+	Multiplier float64
+	Max        int
+}
+
+func (b RestartBackoff) VerifyParams() bool {
+	return b.Initial >= 0 && b.Multiplier >= 0 && b.Max >= 0
+}
+
+// Delay returns how long to wait before the next restart, after the pod has been restarted restartCount times
+func (b RestartBackoff) Delay(restartCount int) time.Duration {
+	if b.Initial <= 0 || restartCount <= 0 {
+		return 0
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = kDefaultRestartBackoffMultiplier
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < restartCount; i += 1 {
+		delay *= multiplier
+		if b.Max > 0 && delay >= float64(b.Max) {
+			break
+		}
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
+// JobSpec makes the pod group run to completion, every instance should exit 0 once,
+// so NumInstances is the completions of the job.
+type JobSpec struct {
+	Parallelism             int // the max number of running instances, 0 means all of them
+	BackoffLimit            int // the failed runs allowed before the job fails
+	ActiveDeadline          int // the seconds the job can run since it started, 0 means no deadline
+	TTLSecondsAfterFinished int // the finished job is removed after it, 0 means keeping it
+}
+
+func (j JobSpec) VerifyParams() bool {
+	return j.Parallelism >= 0 && j.BackoffLimit >= 0 && j.ActiveDeadline >= 0 && j.TTLSecondsAfterFinished >= 0
+}
+
+func (j JobSpec) GetParallelism(numInstances int) int {
+	if j.Parallelism > 0 && j.Parallelism < numInstances {
+		return j.Parallelism
+	}
+	return numInstances
+}
+
+const (
+	CronConcurrencyAllow   = "allow"
+	CronConcurrencyForbid  = "forbid"
+	CronConcurrencyReplace = "replace"
+)
+
+// CronSpec starts a fresh run of the job at each scheduled time, every run is a job pod group of its own
+type CronSpec struct {
+	Schedule          string // the standard 5 fields cron expression, e.g. "30 2 * * *" or @daily
+	ConcurrencyPolicy string // allow, forbid or replace the active runs, empty means allow
+	HistoryLimit      int    // the number of the finished runs kept, 0 means 3
+}
+
+func (s CronSpec) VerifyParams() bool {
+	if _, err := cron.Parse(s.Schedule); err != nil {
+		return false
+	}
+	switch s.ConcurrencyPolicy {
+	case "", CronConcurrencyAllow, CronConcurrencyForbid, CronConcurrencyReplace:
+	default:
+		return false
+	}
+	return s.HistoryLimit >= 0
+}
+
+func (s CronSpec) GetHistoryLimit() int {
+	if s.HistoryLimit > 0 {
+		return s.HistoryLimit
+	}
+	return 3
+}
+
+// DaemonSpec runs one instance on every eligible node, the instances are added and removed with the nodes
+type DaemonSpec struct {
+	Nodes []string // maintained by deployd, Nodes[i] is the node of the instance i+1, empty if the slot is vacant
+}
+
+// ActiveNodes returns the nodes which have the daemon instances, the vacant slots are skipped
+func (d DaemonSpec) ActiveNodes() []string {
+	nodes := make([]string, 0, len(d.Nodes))
+	for _, node := range d.Nodes {
+		if node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (d DaemonSpec) Clone() DaemonSpec {
+	n := d
+	n.Nodes = make([]string, len(d.Nodes))
+	copy(n.Nodes, d.Nodes)
+	return n
+}
+
+func (d DaemonSpec) Equals(o DaemonSpec) bool {
+	if len(d.Nodes) != len(o.Nodes) {
+		return false
+	}
+	for i := range d.Nodes {
+		if d.Nodes[i] != o.Nodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
 type PodGroupSpec struct {
 	ImSpec
-	Pod           PodSpec
-	NumInstances  int
-	RestartPolicy RestartPolicy
+	Pod             PodSpec
+	NumInstances    int
+	RestartPolicy   RestartPolicy
+	RestartMaxCount int // overrides the global RestartMaxCount if > 0
+	RestartBackoff  RestartBackoff
+	RollingUpdate   RollingUpdateStrategy
+	Canary          *CanarySpec
+	Stopped         bool // the pod group is stopped on purpose, refresh and restart will leave it alone
+	Paused          bool // the auto healing is paused, refresh only snapshots the runtime
+	TopologySpread  TopologySpreadSpec
+	Job             *JobSpec    // nil means a long running service
+	Cron            *CronSpec   // the job is run on the schedule instead of once, Job must be set
+	Daemon          *DaemonSpec // NumInstances follows the eligible nodes if it is set
+	Ordered         bool        // the stateful instances are deployed, scaled and upgraded one by one in order
+	VolumeRetention VolumeRetentionSpec
+}
+
+// IsAutoHealing returns whether the refresh can restart, redeploy or upgrade the instances
+func (spec PodGroupSpec) IsAutoHealing() bool {
+	return !spec.Stopped && !spec.Paused
+}
+
+func (spec PodGroupSpec) GetRestartMaxCount() int {
+	if spec.RestartMaxCount > 0 {
+		return spec.RestartMaxCount
+	}
+	return RestartMaxCount
 }
 
 func (spec PodGroupSpec) String() string {
@@ -428,25 +1053,157 @@ func (spec PodGroupSpec) String() string {
 func (spec PodGroupSpec) Clone() PodGroupSpec {
 	newSpec := spec
 	newSpec.Pod = spec.Pod.Clone()
+	if spec.Canary != nil {
+		canary := spec.Canary.Clone()
+		newSpec.Canary = &canary
+	}
+	if spec.Job != nil {
+		job := *spec.Job
+		newSpec.Job = &job
+	}
+	if spec.Cron != nil {
+		cronSpec := *spec.Cron
+		newSpec.Cron = &cronSpec
+	}
+	if spec.Daemon != nil {
+		daemon := spec.Daemon.Clone()
+		newSpec.Daemon = &daemon
+	}
 	return newSpec
 }
 
+func (spec PodGroupSpec) IsJob() bool {
+	return spec.Job != nil
+}
+
+func (spec PodGroupSpec) IsDaemon() bool {
+	return spec.Daemon != nil
+}
+
+// DaemonNode returns the node which the daemon instance is pinned to, empty for the other pod groups
+func (spec PodGroupSpec) DaemonNode(instanceNo int) string {
+	if spec.Daemon == nil || instanceNo < 1 || instanceNo > len(spec.Daemon.Nodes) {
+		return ""
+	}
+	return spec.Daemon.Nodes[instanceNo-1]
+}
+
+// IsVacantInstance checks whether the daemon instance has lost its node, nothing runs in the slot
+func (spec PodGroupSpec) IsVacantInstance(instanceNo int) bool {
+	return spec.Daemon != nil && spec.DaemonNode(instanceNo) == ""
+}
+
+// InstanceHostname is the stable hostname of the ordered instance, e.g. hello-proc-db-1
+func (spec PodGroupSpec) InstanceHostname(instanceNo int) string {
+	if !spec.Ordered {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d", strings.Replace(spec.Name, ".", "-", -1), instanceNo)
+}
+
+// VerifyHostnames checks the hostnames of the ordered instances up to numInstances, docker rejects the
+// hostname longer than 63 characters
+func (spec PodGroupSpec) VerifyHostnames(numInstances int) bool {
+	if numInstances < 1 {
+		numInstances = 1
+	}
+	return len(spec.InstanceHostname(numInstances)) <= kMaxHostnameLength
+}
+
+func (spec PodGroupSpec) IsCron() bool {
+	return spec.Cron != nil
+}
+
+// CronRunSpec is the job pod group spec of one run, the run has its own name so the instances never overlap
+func (spec PodGroupSpec) CronRunSpec(name string) PodGroupSpec {
+	runSpec := spec.Clone()
+	runSpec.Cron = nil
+	runSpec.Canary = nil
+	runSpec.Name = name
+	runSpec.CreatedAt = time.Now()
+	runSpec.UpdatedAt = runSpec.CreatedAt
+	runSpec.Pod.ImSpec = runSpec.ImSpec
+	return runSpec
+}
+
+func (spec PodGroupSpec) IsCanaryInstance(instanceNo int) bool {
+	return spec.Canary != nil && instanceNo <= spec.Canary.NumInstances
+}
+
+// InstancePodSpec returns the pod spec which the instance should run, the canary instances run the canary pod spec
+func (spec PodGroupSpec) InstancePodSpec(instanceNo int) PodSpec {
+	if spec.IsCanaryInstance(instanceNo) {
+		return spec.Canary.Pod
+	}
+	return spec.Pod
+}
+
+// InstanceVersion returns the version which the instance should run
+func (spec PodGroupSpec) InstanceVersion(instanceNo int) int {
+	if spec.IsCanaryInstance(instanceNo) {
+		return spec.Canary.Pod.Version
+	}
+	return spec.Version
+}
+
 func (spec PodGroupSpec) Equals(o PodGroupSpec) bool {
 	return spec.Name == o.Name &&
 		spec.Namespace == o.Namespace &&
 		spec.Version == o.Version &&
 		spec.Pod.Equals(o.Pod) &&
 		spec.NumInstances == o.NumInstances &&
-		spec.RestartPolicy == o.RestartPolicy
+		spec.RestartPolicy == o.RestartPolicy &&
+		spec.RestartMaxCount == o.RestartMaxCount &&
+		spec.RestartBackoff == o.RestartBackoff &&
+		spec.RollingUpdate == o.RollingUpdate &&
+		spec.Stopped == o.Stopped &&
+		spec.Paused == o.Paused &&
+		spec.TopologySpread == o.TopologySpread &&
+		spec.Ordered == o.Ordered &&
+		spec.VolumeRetention == o.VolumeRetention &&
+		((spec.Job == nil && o.Job == nil) ||
+			(spec.Job != nil && o.Job != nil && *spec.Job == *o.Job)) &&
+		((spec.Cron == nil && o.Cron == nil) ||
+			(spec.Cron != nil && o.Cron != nil && *spec.Cron == *o.Cron)) &&
+		((spec.Daemon == nil && o.Daemon == nil) ||
+			(spec.Daemon != nil && o.Daemon != nil && spec.Daemon.Equals(*o.Daemon))) &&
+		((spec.Canary == nil && o.Canary == nil) ||
+			(spec.Canary != nil && o.Canary != nil && spec.Canary.Equals(*o.Canary)))
 }
 
 func (spec PodGroupSpec) VerifyParams() bool {
 	verify := spec.Name != "" &&
 		spec.Namespace != "" &&
-		spec.NumInstances >= 0
+		spec.NumInstances >= 0 &&
+		spec.RestartMaxCount >= 0 &&
+		spec.RestartBackoff.VerifyParams() &&
+		spec.RollingUpdate.VerifyParams() &&
+		spec.TopologySpread.VerifyParams() &&
+		spec.VolumeRetention.VerifyParams()
 	if !verify {
 		return false
 	}
+	if spec.Job != nil && !spec.Job.VerifyParams() {
+		return false
+	}
+	if spec.Cron != nil && (spec.Job == nil || !spec.Cron.VerifyParams()) {
+		return false
+	}
+	if spec.Daemon != nil && (spec.Job != nil || spec.TopologySpread.IsEnabled()) {
+		return false
+	}
+	if spec.Daemon != nil {
+		// the daemon can not know which nodes the required pod affinities allow
+		for _, a := range spec.Pod.Affinity.Pods {
+			if a.Required {
+				return false
+			}
+		}
+	}
+	if spec.Ordered && (!spec.Pod.IsStateful() || spec.Job != nil || spec.Daemon != nil ||
+		!spec.VerifyHostnames(spec.NumInstances)) {
+		return false
+	}
 	return spec.Pod.VerifyParams()
 }
 
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartBackoffDelay(t *testing.T) {
+	tests := []struct {
+		backoff      RestartBackoff
+		restartCount int
+		delay        time.Duration
+	}{
+		// no backoff without the initial delay
+		{RestartBackoff{}, 3, 0},
+		{RestartBackoff{Initial: 0, Multiplier: 2, Max: 60}, 3, 0},
+		// the first restart is not delayed
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 0, 0},
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, -1, 0},
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 1, 10 * time.Second},
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 2, 20 * time.Second},
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 3, 40 * time.Second},
+		// capped by the max
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 4, 60 * time.Second},
+		{RestartBackoff{Initial: 10, Multiplier: 2, Max: 60}, 1000, 60 * time.Second},
+		{RestartBackoff{Initial: 100, Multiplier: 2, Max: 60}, 1, 60 * time.Second},
+		// the multiplier less than 1 falls back to the default one
+		{RestartBackoff{Initial: 10}, 3, 40 * time.Second},
+		{RestartBackoff{Initial: 10, Multiplier: 0.5}, 2, 20 * time.Second},
+		{RestartBackoff{Initial: 10, Multiplier: 1}, 5, 10 * time.Second},
+		{RestartBackoff{Initial: 2, Multiplier: 1.5}, 3, 4500 * time.Millisecond},
+		// zero max means no cap
+		{RestartBackoff{Initial: 1, Multiplier: 10}, 4, 1000 * time.Second},
+	}
+	for i, test := range tests {
+		if delay := test.backoff.Delay(test.restartCount); delay != test.delay {
+			t.Errorf("Case %d should delay %s after %d restarts, got %s", i, test.delay, test.restartCount, delay)
+		}
+	}
+}
+
+func TestRollingUpdateNormalize(t *testing.T) {
+	tests := []struct {
+		strategy           RollingUpdateStrategy
+		numInstances       int
+		surge, unavailable int
+	}{
+		// the zero strategy removes and deploys one by one
+		{RollingUpdateStrategy{}, 5, 0, 1},
+		{RollingUpdateStrategy{MaxSurge: -1, MaxUnavailable: -1}, 5, 0, 1},
+		{RollingUpdateStrategy{MaxSurge: 2}, 5, 2, 0},
+		{RollingUpdateStrategy{MaxUnavailable: 3}, 5, 0, 3},
+		{RollingUpdateStrategy{MaxSurge: 1, MaxUnavailable: 2}, 5, 1, 2},
+		// capped by the instance count
+		{RollingUpdateStrategy{MaxSurge: 10, MaxUnavailable: 10}, 3, 3, 3},
+		{RollingUpdateStrategy{}, 0, 0, 0},
+	}
+	for i, test := range tests {
+		surge, unavailable := test.strategy.Normalize(test.numInstances)
+		if surge != test.surge || unavailable != test.unavailable {
+			t.Errorf("Case %d should be surge=%d unavailable=%d, got surge=%d unavailable=%d",
+				i, test.surge, test.unavailable, surge, unavailable)
+		}
+	}
+}
+
+func TestRollingUpdateRemoveDelay(t *testing.T) {
+	tests := []struct {
+		removeDelay int
+		delay       int
+	}{
+		{0, kDefaultRemoveDelay},
+		{-1, 0},
+		{5, 5},
+	}
+	for _, test := range tests {
+		if delay := (RollingUpdateStrategy{RemoveDelay: test.removeDelay}).GetRemoveDelay(); delay != test.delay {
+			t.Errorf("RemoveDelay %d should wait %d seconds, got %d", test.removeDelay, test.delay, delay)
+		}
+	}
+}
+
+func TestRolloutBatch(t *testing.T) {
+	stateless := PodSpec{Containers: []ContainerSpec{{}}}
+	stateful := PodSpec{Containers: []ContainerSpec{{Volumes: []string{"/var/lib/mysql"}}}}
+	tests := []struct {
+		spec               PodGroupSpec
+		oldSpec, newSpec   PodSpec
+		surge, unavailable int
+	}{
+		{PodGroupSpec{RollingUpdate: RollingUpdateStrategy{MaxSurge: 2, MaxUnavailable: 1}}, stateless, stateless, 2, 1},
+		// the stateful instances never surge, either before or after the update
+		{PodGroupSpec{RollingUpdate: RollingUpdateStrategy{MaxSurge: 2, MaxUnavailable: 1}}, stateful, stateless, 0, 1},
+		{PodGroupSpec{RollingUpdate: RollingUpdateStrategy{MaxSurge: 2}}, stateless, stateful, 0, 1},
+		{PodGroupSpec{RollingUpdate: RollingUpdateStrategy{MaxUnavailable: 3}}, stateful, stateful, 0, 3},
+		// the ordered pod group is upgraded one by one
+		{PodGroupSpec{RollingUpdate: RollingUpdateStrategy{MaxSurge: 2, MaxUnavailable: 3}, Ordered: true}, stateless, stateless, 0, 1},
+	}
+	for i, test := range tests {
+		surge, unavailable := test.spec.RolloutBatch(5, test.oldSpec, test.newSpec)
+		if surge != test.surge || unavailable != test.unavailable {
+			t.Errorf("Case %d should be surge=%d unavailable=%d, got surge=%d unavailable=%d",
+				i, test.surge, test.unavailable, surge, unavailable)
+		}
+	}
+}
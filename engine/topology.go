@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/sweb/log"
+)
+
+const (
+	TopologyKeyZone = "zone"
+	TopologyKeyRack = "rack"
+)
+
+var topoController *topologyController
+
+// NodeTopology is the failure domains of the node
+type NodeTopology struct {
+	Node string
+	Zone string
+	Rack string
+}
+
+func (t NodeTopology) VerifyParams() bool {
+	return t.Node != "" && (t.Zone != "" || t.Rack != "")
+}
+
+func (t NodeTopology) Domain(key string) string {
+	switch key {
+	case TopologyKeyZone:
+		return t.Zone
+	case TopologyKeyRack:
+		return t.Rack
+	}
+	return ""
+}
+
+// TopologySpreadSpec bounds the difference of the instance count between the domains,
+// it is enforced by the native scheduler when the instances are deployed, scaled up or drifted.
+type TopologySpreadSpec struct {
+	Key     string // zone or rack, empty means disabled
+	MaxSkew int
+}
+
+func (s TopologySpreadSpec) IsEnabled() bool {
+	return s.Key != ""
+}
+
+func (s TopologySpreadSpec) VerifyParams() bool {
+	if !s.IsEnabled() {
+		return s.MaxSkew == 0
+	}
+	return (s.Key == TopologyKeyZone || s.Key == TopologyKeyRack) && s.MaxSkew > 0
+}
+
+// TopologySkew is the current instance count of each domain
+type TopologySkew struct {
+	Key      string
+	MaxSkew  int
+	Domains  map[string]int
+	Unknown  int // the instances on the nodes without the domain or not deployed yet
+	Skew     int
+	Violated bool
+}
+
+type topologyController struct {
+	sync.RWMutex
+
+	nodes map[string]NodeTopology
+}
+
+func NewTopologyController() *topologyController {
+	return &topologyController{
+		nodes: make(map[string]NodeTopology),
+	}
+}
+
+func (tc *topologyController) LoadTopologies(store storage.Store) error {
+	nodes := make(map[string]NodeTopology)
+	nodesKey := fmt.Sprintf("%s/%s", kLainDeploydRootKey, kLainNodesKey)
+	if keys, err := store.KeysByPrefix(nodesKey); err != nil {
+		if err != storage.ErrNoSuchKey {
+			return err
+		}
+	} else {
+		for _, key := range keys {
+			var topology NodeTopology
+			if err := store.Get(key, &topology); err != nil {
+				log.Errorf("Failed to load node topology %s from storage, %s", key, err)
+				return err
+			}
+			nodes[topology.Node] = topology
+			log.Infof("Loaded node topology %s from storage, %+v", topology.Node, topology)
+		}
+	}
+	tc.Lock()
+	tc.nodes = nodes
+	tc.Unlock()
+	return nil
+}
+
+func (tc *topologyController) GetTopology(node string) (NodeTopology, bool) {
+	tc.RLock()
+	defer tc.RUnlock()
+	topology, ok := tc.nodes[node]
+	return topology, ok
+}
+
+func (tc *topologyController) GetAllTopologies() []NodeTopology {
+	tc.RLock()
+	defer tc.RUnlock()
+	topologies := make([]NodeTopology, 0, len(tc.nodes))
+	for _, topology := range tc.nodes {
+		topologies = append(topologies, topology)
+	}
+	sort.Sort(topologiesByNode(topologies))
+	return topologies
+}
+
+// Domains maps the node to its domain of the key
+func (tc *topologyController) Domains(key string) map[string]string {
+	tc.RLock()
+	defer tc.RUnlock()
+	domains := make(map[string]string)
+	for node, topology := range tc.nodes {
+		if domain := topology.Domain(key); domain != "" {
+			domains[node] = domain
+		}
+	}
+	return domains
+}
+
+func (tc *topologyController) SetTopology(topology NodeTopology, store storage.Store) error {
+	tc.Lock()
+	defer tc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainNodesKey, topology.Node)
+	if err := store.Set(key, topology); err != nil {
+		log.Warnf("Failed to set node topology key %s, %s", key, err)
+		return err
+	}
+	tc.nodes[topology.Node] = topology
+	return nil
+}
+
+func (tc *topologyController) RemoveTopology(node string, store storage.Store) error {
+	tc.Lock()
+	defer tc.Unlock()
+	key := fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainNodesKey, node)
+	if err := store.Remove(key); err != nil {
+		log.Warnf("Failed to remove node topology key %s, %s", key, err)
+		return err
+	}
+	delete(tc.nodes, node)
+	return nil
+}
+
+// calcTopologySkew counts the instances by the domains of their nodes, the domains without instances are
+// included so the skew covers all the known domains.
+func calcTopologySkew(spread TopologySpreadSpec, domains map[string]string, nodeNames []string) TopologySkew {
+	skew := TopologySkew{
+		Key:     spread.Key,
+		MaxSkew: spread.MaxSkew,
+		Domains: make(map[string]int),
+	}
+	for _, domain := range domains {
+		skew.Domains[domain] = 0
+	}
+	for _, nodeName := range nodeNames {
+		if domain, ok := domains[nodeName]; ok {
+			skew.Domains[domain] += 1
+		} else {
+			skew.Unknown += 1
+		}
+	}
+	first := true
+	min, max := 0, 0
+	for _, count := range skew.Domains {
+		if first || count < min {
+			min = count
+		}
+		if first || count > max {
+			max = count
+		}
+		first = false
+	}
+	skew.Skew = max - min
+	skew.Violated = spread.MaxSkew > 0 && skew.Skew > spread.MaxSkew
+	return skew
+}
+
+type topologiesByNode []NodeTopology
+
+func (t topologiesByNode) Len() int           { return len(t) }
+func (t topologiesByNode) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t topologiesByNode) Less(i, j int) bool { return t[i].Node < t[j].Node }
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestCalcTopologySkew(t *testing.T) {
+	domains := map[string]string{"node1": "rack1", "node2": "rack1", "node3": "rack2", "node4": "rack3"}
+	tests := []struct {
+		nodeNames []string
+		maxSkew   int
+		counts    map[string]int
+		unknown   int
+		skew      int
+		violated  bool
+	}{
+		{nil, 1, map[string]int{"rack1": 0, "rack2": 0, "rack3": 0}, 0, 0, false},
+		{[]string{"node1", "node3", "node4"}, 1, map[string]int{"rack1": 1, "rack2": 1, "rack3": 1}, 0, 0, false},
+		{[]string{"node1", "node2", "node3"}, 1, map[string]int{"rack1": 2, "rack2": 1, "rack3": 0}, 0, 2, true},
+		{[]string{"node1", "node2", "node3"}, 2, map[string]int{"rack1": 2, "rack2": 1, "rack3": 0}, 0, 2, false},
+		{[]string{"node1", "", "node5"}, 1, map[string]int{"rack1": 1, "rack2": 0, "rack3": 0}, 2, 1, false},
+		{[]string{"node1", "node2"}, 0, map[string]int{"rack1": 2, "rack2": 0, "rack3": 0}, 0, 2, false},
+	}
+	for i, test := range tests {
+		spread := TopologySpreadSpec{Key: "rack", MaxSkew: test.maxSkew}
+		skew := calcTopologySkew(spread, domains, test.nodeNames)
+		if skew.Key != "rack" || skew.MaxSkew != test.maxSkew {
+			t.Errorf("Case %d should keep the spread spec, got %+v", i, skew)
+		}
+		if len(skew.Domains) != len(test.counts) {
+			t.Errorf("Case %d should count all the domains, got %v", i, skew.Domains)
+		}
+		for domain, count := range test.counts {
+			if skew.Domains[domain] != count {
+				t.Errorf("Case %d domain %s should have %d instances, got %d", i, domain, count, skew.Domains[domain])
+			}
+		}
+		if skew.Unknown != test.unknown || skew.Skew != test.skew || skew.Violated != test.violated {
+			t.Errorf("Case %d should be unknown=%d skew=%d violated=%v, got %+v",
+				i, test.unknown, test.skew, test.violated, skew)
+		}
+	}
+
+	skew := calcTopologySkew(TopologySpreadSpec{Key: "zone", MaxSkew: 1}, nil, []string{"node1"})
+	if len(skew.Domains) != 0 || skew.Unknown != 1 || skew.Skew != 0 || skew.Violated {
+		t.Errorf("Instances without the domains should be unknown, got %+v", skew)
+	}
+}
@@ -0,0 +1,450 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laincloud/deployd/cluster"
+	"github.com/laincloud/deployd/storage"
+	"github.com/mijia/adoc"
+	"github.com/mijia/sweb/log"
+)
+
+const (
+	VolumeRetain  = "retain"
+	VolumeDelete  = "delete"
+	VolumeArchive = "archive"
+
+	VolumeStateInUse    = "inuse"
+	VolumeStateReleased = "released"
+	VolumeStateCleaning = "cleaning"
+	VolumeStateArchived = "archived"
+	VolumeStateFailed   = "failed"
+
+	kLainVolumeArchiveRoot = "/data/lain/volume-archives"
+)
+
+var volController *volumeController
+
+// VolumeRetentionSpec decides what to do with the volume directories once the instance is removed
+// from the node, by removing the pod group, scaling it down or moving the instance to another node.
+type VolumeRetentionSpec struct {
+	Policy      string // retain, delete or archive, empty means retain
+	GracePeriod int    // the seconds to wait before deleting or archiving
+}
+
+func (s VolumeRetentionSpec) VerifyParams() bool {
+	switch s.Policy {
+	case "", VolumeRetain, VolumeDelete, VolumeArchive:
+	default:
+		return false
+	}
+	return s.GracePeriod >= 0
+}
+
+func (s VolumeRetentionSpec) GetPolicy() string {
+	if s.Policy == "" {
+		return VolumeRetain
+	}
+	return s.Policy
+}
+
+// VolumeRecord is the volume directories of one instance on one node
+type VolumeRecord struct {
+	Namespace  string
+	PodGroup   string
+	InstanceNo int
+	Node       string
+	Paths      []string
+	State      string
+	Retention  VolumeRetentionSpec
+	ReleasedAt time.Time
+	CleanAt    time.Time
+	Archive    string // the archive file on the node
+	LastError  string
+	UpdatedAt  time.Time
+}
+
+func (r VolumeRecord) Clone() VolumeRecord {
+	n := r
+	n.Paths = make([]string, len(r.Paths))
+	copy(n.Paths, r.Paths)
+	return n
+}
+
+func (r VolumeRecord) String() string {
+	return fmt.Sprintf("<Volume %s/%d@%s state=%s>", r.PodGroup, r.InstanceNo, r.Node, r.State)
+}
+
+// VolumeEvent is emitted by the pod group controller when the instance with volumes is added or verified
+type VolumeEvent struct {
+	Type       string
+	Spec       PodSpec
+	InstanceNo int
+	NodeName   string
+	Retention  VolumeRetentionSpec
+}
+
+// instanceVolumePaths returns the host directories of the instance, they are the roots of the binds
+// in createHostConfig. The cloud volumes shared by the instances are not included.
+func instanceVolumePaths(spec PodSpec, instanceNo int) []string {
+	var paths []string
+	for _, cSpec := range spec.Containers {
+		if len(cSpec.Volumes) > 0 {
+			paths = append(paths, fmt.Sprintf("%s/%s/%s/%d", kLainVolumeRoot, spec.Namespace, spec.Name, instanceNo))
+			break
+		}
+	}
+	for _, cSpec := range spec.Containers {
+		multiMode := false
+		for _, cv := range cSpec.CloudVolumes {
+			if cv.Type == CloudVolumeMultiMode && len(cv.Dirs) > 0 {
+				multiMode = true
+			}
+		}
+		if multiMode {
+			paths = append(paths, fmt.Sprintf("%s/%s/%s/%d", kLainCloudVolumeRoot, spec.Namespace, spec.Name, instanceNo))
+			break
+		}
+	}
+	return paths
+}
+
+type volumeController struct {
+	sync.RWMutex
+
+	volumes map[string][]VolumeRecord // pod group name to its records
+}
+
+func NewVolumeController() *volumeController {
+	return &volumeController{
+		volumes: make(map[string][]VolumeRecord),
+	}
+}
+
+func (vc *volumeController) LoadVolumes(store storage.Store) error {
+	volumes := make(map[string][]VolumeRecord)
+	volumesKey := fmt.Sprintf("%s/%s", kLainDeploydRootKey, kLainVolumeKey)
+	if namespaces, err := store.KeysByPrefix(volumesKey); err != nil {
+		if err != storage.ErrNoSuchKey {
+			return err
+		}
+	} else {
+		for _, namespace := range namespaces {
+			keys, err := store.KeysByPrefix(namespace)
+			if err != nil && err != storage.ErrNoSuchKey {
+				return err
+			}
+			for _, key := range keys {
+				var records []VolumeRecord
+				if err := store.Get(key, &records); err != nil {
+					log.Errorf("Failed to load volumes %s from storage, %s", key, err)
+					return err
+				}
+				for i := range records {
+					if records[i].State == VolumeStateCleaning {
+						// the helper went away with the former leader, try it again
+						records[i].State = VolumeStateReleased
+					}
+				}
+				if len(records) > 0 {
+					volumes[records[0].PodGroup] = records
+					log.Infof("Loaded %d volumes of %s from storage", len(records), records[0].PodGroup)
+				}
+			}
+		}
+	}
+	vc.Lock()
+	vc.volumes = volumes
+	vc.Unlock()
+	return nil
+}
+
+// GetVolumes returns the records of the pod group, or all the records if name is empty
+func (vc *volumeController) GetVolumes(name string) []VolumeRecord {
+	vc.RLock()
+	defer vc.RUnlock()
+	var records []VolumeRecord
+	for pgName, pgRecords := range vc.volumes {
+		if name != "" && pgName != name {
+			continue
+		}
+		for _, record := range pgRecords {
+			records = append(records, record.Clone())
+		}
+	}
+	sort.Sort(volumesByInstance(records))
+	return records
+}
+
+// save should be called with the lock held
+func (vc *volumeController) save(namespace, name string, store storage.Store) {
+	key := fmt.Sprintf("%s/%s/%s/%s", kLainDeploydRootKey, kLainVolumeKey, namespace, name)
+	records := vc.volumes[name]
+	if len(records) == 0 {
+		delete(vc.volumes, name)
+		if err := store.Remove(key); err != nil && err != storage.ErrNoSuchKey {
+			log.Warnf("Failed to remove volumes key %s, %s", key, err)
+		}
+		store.TryRemoveDir(fmt.Sprintf("%s/%s/%s", kLainDeploydRootKey, kLainVolumeKey, namespace))
+		return
+	}
+	if err := store.Set(key, records, true); err != nil {
+		log.Warnf("Failed to set volumes key %s, %s", key, err)
+	}
+}
+
+// Track marks the volumes of the instance on the node in use, the volumes of the instance left on
+// the other nodes are released.
+func (vc *volumeController) Track(event VolumeEvent, store storage.Store) {
+	paths := instanceVolumePaths(event.Spec, event.InstanceNo)
+	if len(paths) == 0 || event.NodeName == "" {
+		return
+	}
+	vc.Lock()
+	defer vc.Unlock()
+	now := time.Now()
+	name := event.Spec.Name
+	found, changed := false, false
+	records := vc.volumes[name]
+	for i := range records {
+		record := &records[i]
+		if record.InstanceNo != event.InstanceNo {
+			continue
+		}
+		if record.Node == event.NodeName {
+			found = true
+			if record.State != VolumeStateInUse || record.Retention != event.Retention {
+				log.Infof("<VolumeCtrl> %s is in use again", record)
+				record.State = VolumeStateInUse
+				record.Paths = paths
+				record.Retention = event.Retention
+				record.LastError = ""
+				record.UpdatedAt = now
+				changed = true
+			}
+		} else if record.State == VolumeStateInUse {
+			log.Infof("<VolumeCtrl> instance moved to %s, release %s", event.NodeName, record)
+			record.release(event.Retention, now)
+			changed = true
+		}
+	}
+	if !found {
+		records = append(records, VolumeRecord{
+			Namespace:  event.Spec.Namespace,
+			PodGroup:   name,
+			InstanceNo: event.InstanceNo,
+			Node:       event.NodeName,
+			Paths:      paths,
+			State:      VolumeStateInUse,
+			Retention:  event.Retention,
+			UpdatedAt:  now,
+		})
+		changed = true
+	}
+	if changed {
+		vc.volumes[name] = records
+		vc.save(event.Spec.Namespace, name, store)
+	}
+}
+
+func (r *VolumeRecord) release(retention VolumeRetentionSpec, now time.Time) {
+	r.State = VolumeStateReleased
+	r.Retention = retention
+	r.ReleasedAt = now
+	r.CleanAt = now.Add(time.Duration(retention.GracePeriod) * time.Second)
+	r.UpdatedAt = now
+}
+
+// Release releases the volumes of the instances after fromInstanceNo, all of them if it is 0
+func (vc *volumeController) Release(name string, fromInstanceNo int, retention VolumeRetentionSpec, store storage.Store) {
+	vc.Lock()
+	defer vc.Unlock()
+	now := time.Now()
+	records := vc.volumes[name]
+	changed := false
+	for i := range records {
+		if record := &records[i]; record.State == VolumeStateInUse && record.InstanceNo > fromInstanceNo {
+			log.Infof("<VolumeCtrl> release %s, policy=%s", record, retention.GetPolicy())
+			record.release(retention, now)
+			changed = true
+		}
+	}
+	if changed {
+		vc.save(records[0].Namespace, name, store)
+	}
+}
+
+// Clean deletes the released or retained volumes of the instance on the node right away
+func (vc *volumeController) Clean(name string, instanceNo int, node string, store storage.Store) error {
+	vc.Lock()
+	defer vc.Unlock()
+	records := vc.volumes[name]
+	for i := range records {
+		record := &records[i]
+		if record.InstanceNo != instanceNo || record.Node != node {
+			continue
+		}
+		if record.State == VolumeStateInUse || record.State == VolumeStateCleaning {
+			return ErrVolumeInUse
+		}
+		now := time.Now()
+		record.State = VolumeStateReleased
+		record.Retention = VolumeRetentionSpec{Policy: VolumeDelete}
+		record.CleanAt = now
+		record.LastError = ""
+		record.UpdatedAt = now
+		vc.save(record.Namespace, name, store)
+		return nil
+	}
+	return ErrVolumeNotExists
+}
+
+// dueRecords returns the released records which should be deleted or archived now
+func (vc *volumeController) dueRecords(now time.Time) []VolumeRecord {
+	vc.RLock()
+	defer vc.RUnlock()
+	var due []VolumeRecord
+	for _, records := range vc.volumes {
+		for _, record := range records {
+			if record.State == VolumeStateReleased && record.Retention.GetPolicy() != VolumeRetain && !now.Before(record.CleanAt) {
+				due = append(due, record.Clone())
+			}
+		}
+	}
+	return due
+}
+
+// markCleaning returns false if the record is not released any more, e.g. the instance is back on the node
+func (vc *volumeController) markCleaning(target VolumeRecord, store storage.Store) bool {
+	vc.Lock()
+	defer vc.Unlock()
+	records := vc.volumes[target.PodGroup]
+	for i := range records {
+		record := &records[i]
+		if record.InstanceNo != target.InstanceNo || record.Node != target.Node {
+			continue
+		}
+		if record.State != VolumeStateReleased {
+			return false
+		}
+		record.State = VolumeStateCleaning
+		record.UpdatedAt = time.Now()
+		vc.save(target.Namespace, target.PodGroup, store)
+		return true
+	}
+	return false
+}
+
+// finish records the result of the helper, the deleted records are dropped from the inventory
+func (vc *volumeController) finish(target VolumeRecord, archive string, err error, store storage.Store) {
+	vc.Lock()
+	defer vc.Unlock()
+	records := vc.volumes[target.PodGroup]
+	for i := range records {
+		record := &records[i]
+		if record.InstanceNo != target.InstanceNo || record.Node != target.Node || record.State != VolumeStateCleaning {
+			continue
+		}
+		record.UpdatedAt = time.Now()
+		switch {
+		case err != nil:
+			record.State = VolumeStateFailed
+			record.LastError = err.Error()
+		case archive != "":
+			record.State = VolumeStateArchived
+			record.Archive = archive
+		default:
+			records = append(records[:i], records[i+1:]...)
+		}
+		vc.volumes[target.PodGroup] = records
+		vc.save(target.Namespace, target.PodGroup, store)
+		return
+	}
+}
+
+// runVolumeHelper deletes or archives the directories by a short-lived container on the node of the volumes
+func runVolumeHelper(c cluster.Cluster, record VolumeRecord) (string, error) {
+	var binds, targets []string
+	for i, path := range record.Paths {
+		binds = append(binds, fmt.Sprintf("%s:/volumes/%d", filepath.Dir(path), i))
+		targets = append(targets, fmt.Sprintf("volumes/%d/%s", i, filepath.Base(path)))
+	}
+	archive := ""
+	script := ""
+	if record.Retention.GetPolicy() == VolumeArchive {
+		fileName := fmt.Sprintf("%s-%d-%d.tar.gz", record.PodGroup, record.InstanceNo, time.Now().Unix())
+		archive = fmt.Sprintf("%s/%s/%s", kLainVolumeArchiveRoot, record.Namespace, fileName)
+		binds = append(binds, fmt.Sprintf("%s/%s:/archive", kLainVolumeArchiveRoot, record.Namespace))
+		script = fmt.Sprintf("cd / && tar czf /archive/%s %s && ", fileName, strings.Join(targets, " "))
+	}
+	script += fmt.Sprintf("cd / && rm -rf %s", strings.Join(targets, " "))
+
+	cc := adoc.ContainerConfig{
+		Cmd: []string{"sh", "-c", script},
+		Env: []string{nodeFilter(record.Node, true)},
+	}
+	hc := adoc.HostConfig{
+		Binds: binds,
+	}
+	name := fmt.Sprintf("deployd.volume-helper.%s.%d.%d", record.PodGroup, record.InstanceNo, time.Now().Unix())
+	if _, err := runHelperContainer(c, cc, hc, name, nil); err != nil {
+		return "", err
+	}
+	return archive, nil
+}
+
+type volumesByInstance []VolumeRecord
+
+func (v volumesByInstance) Len() int      { return len(v) }
+func (v volumesByInstance) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v volumesByInstance) Less(i, j int) bool {
+	if v[i].PodGroup != v[j].PodGroup {
+		return v[i].PodGroup < v[j].PodGroup
+	}
+	if v[i].InstanceNo != v[j].InstanceNo {
+		return v[i].InstanceNo < v[j].InstanceNo
+	}
+	return v[i].Node < v[j].Node
+}
+
+// cleanVolumes starts the helpers for the released volumes which are due, it runs every RefreshInterval
+func (engine *OrcEngine) cleanVolumes() {
+	for _, record := range volController.dueRecords(time.Now()) {
+		// the instance may be still there, e.g. the removal is not finished yet
+		if engine.isVolumeInUse(record) || !volController.markCleaning(record, engine.store) {
+			continue
+		}
+		go func(record VolumeRecord) {
+			log.Infof("<VolumeCtrl> start to %s %s", record.Retention.GetPolicy(), record)
+			archive, err := runVolumeHelper(engine.cluster, record)
+			if err != nil {
+				log.Warnf("<VolumeCtrl> Failed to %s %s, %s", record.Retention.GetPolicy(), record, err)
+			}
+			volController.finish(record, archive, err, engine.store)
+		}(record)
+	}
+}
+
+// isVolumeInUse checks whether the instance of the volumes is still running on the node
+func (engine *OrcEngine) isVolumeInUse(record VolumeRecord) bool {
+	engine.RLock()
+	defer engine.RUnlock()
+	if _, ok := engine.rmPgCtrls[record.PodGroup]; ok {
+		return true
+	}
+	pgCtrl, ok := engine.pgCtrls[record.PodGroup]
+	if !ok {
+		return false
+	}
+	for _, pod := range pgCtrl.Inspect().Pods {
+		if pod.InstanceNo == record.InstanceNo && pod.NodeName() == record.Node {
+			return true
+		}
+	}
+	return false
+}
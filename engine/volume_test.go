@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laincloud/deployd/storage"
+)
+
+// memStore keeps the values in memory, only the keys are checked by the tests
+type memStore struct {
+	sync.Mutex
+	values map[string]interface{}
+}
+
+func newMemStore() *memStore {
+	return &memStore{values: make(map[string]interface{})}
+}
+
+func (s *memStore) Get(key string, v interface{}) error {
+	return storage.ErrNoSuchKey
+}
+
+func (s *memStore) Set(key string, v interface{}, force ...bool) error {
+	s.Lock()
+	defer s.Unlock()
+	s.values[key] = v
+	return nil
+}
+
+func (s *memStore) KeysByPrefix(prefix string) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	var keys []string
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memStore) Remove(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return storage.ErrNoSuchKey
+	}
+	delete(s.values, key)
+	return nil
+}
+
+func (s *memStore) TryRemoveDir(key string) {}
+
+func (s *memStore) RemoveDir(key string) error {
+	return nil
+}
+
+func volumeTestEvent(instanceNo int, node string) VolumeEvent {
+	spec := PodSpec{Containers: []ContainerSpec{{Volumes: []string{"/var/lib/mysql"}}}}
+	spec.Name = "hello.proc.db"
+	spec.Namespace = "hello"
+	return VolumeEvent{
+		Spec:       spec,
+		InstanceNo: instanceNo,
+		NodeName:   node,
+		Retention:  VolumeRetentionSpec{Policy: VolumeDelete},
+	}
+}
+
+func volumeState(vc *volumeController, instanceNo int, node string) string {
+	for _, record := range vc.GetVolumes("hello.proc.db") {
+		if record.InstanceNo == instanceNo && record.Node == node {
+			return record.State
+		}
+	}
+	return ""
+}
+
+func TestVolumeTrackMovedInstance(t *testing.T) {
+	vc, store := NewVolumeController(), newMemStore()
+	vc.Track(volumeTestEvent(1, "node1"), store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateInUse {
+		t.Fatalf("Volume should be in use, got %q", state)
+	}
+	vc.Track(volumeTestEvent(1, "node2"), store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateReleased {
+		t.Errorf("Volume left on node1 should be released, got %q", state)
+	}
+	if state := volumeState(vc, 1, "node2"); state != VolumeStateInUse {
+		t.Errorf("Volume on node2 should be in use, got %q", state)
+	}
+	due := vc.dueRecords(time.Now())
+	if len(due) != 1 || due[0].Node != "node1" {
+		t.Fatalf("Only the volume on node1 should be due, got %v", due)
+	}
+	if !vc.markCleaning(due[0], store) {
+		t.Fatalf("Released volume should be marked cleaning")
+	}
+	if vc.markCleaning(due[0], store) {
+		t.Errorf("Volume should not be marked cleaning twice")
+	}
+	vc.finish(due[0], "", nil, store)
+	if state := volumeState(vc, 1, "node1"); state != "" {
+		t.Errorf("Deleted volume should be dropped, got %q", state)
+	}
+	if state := volumeState(vc, 1, "node2"); state != VolumeStateInUse {
+		t.Errorf("Volume on node2 should be kept in use, got %q", state)
+	}
+}
+
+func TestVolumeTrackReuseOnSameNode(t *testing.T) {
+	vc, store := NewVolumeController(), newMemStore()
+	vc.Track(volumeTestEvent(1, "node1"), store)
+	vc.Track(volumeTestEvent(1, "node2"), store)
+	released := vc.dueRecords(time.Now())
+	if len(released) != 1 {
+		t.Fatalf("Volume on node1 should be due, got %v", released)
+	}
+
+	// the instance is back on node1 before the helper starts
+	vc.Track(volumeTestEvent(1, "node1"), store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateInUse {
+		t.Errorf("Volume on node1 should be in use again, got %q", state)
+	}
+	if state := volumeState(vc, 1, "node2"); state != VolumeStateReleased {
+		t.Errorf("Volume on node2 should be released, got %q", state)
+	}
+	if vc.markCleaning(released[0], store) {
+		t.Errorf("Volume in use again should not be cleaned")
+	}
+	for _, record := range vc.dueRecords(time.Now()) {
+		if record.Node == "node1" {
+			t.Errorf("Volume in use again should not be due, got %s", record)
+		}
+	}
+
+	// the result of an earlier helper is ignored once the volume is in use
+	vc.finish(released[0], "", nil, store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateInUse {
+		t.Errorf("Volume in use should not be dropped by the helper, got %q", state)
+	}
+}
+
+func TestVolumeReleaseScaleDown(t *testing.T) {
+	vc, store := NewVolumeController(), newMemStore()
+	for i := 1; i <= 3; i++ {
+		vc.Track(volumeTestEvent(i, "node1"), store)
+	}
+	retention := VolumeRetentionSpec{Policy: VolumeArchive, GracePeriod: 60}
+	vc.Release("hello.proc.db", 1, retention, store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateInUse {
+		t.Errorf("Volume of the kept instance should be in use, got %q", state)
+	}
+	for i := 2; i <= 3; i++ {
+		if state := volumeState(vc, i, "node1"); state != VolumeStateReleased {
+			t.Errorf("Volume of the removed instance %d should be released, got %q", i, state)
+		}
+	}
+	if due := vc.dueRecords(time.Now()); len(due) != 0 {
+		t.Errorf("Volumes should wait for the grace period, got %v", due)
+	}
+	due := vc.dueRecords(time.Now().Add(time.Minute))
+	if len(due) != 2 {
+		t.Fatalf("Volumes should be due after the grace period, got %v", due)
+	}
+	for _, record := range due {
+		if !vc.markCleaning(record, store) {
+			t.Fatalf("Volume %s should be marked cleaning", record)
+		}
+	}
+	vc.finish(due[0], "/data/lain/volume-archives/hello/a.tar.gz", nil, store)
+	vc.finish(due[1], "", errors.New("helper failed"), store)
+	for _, record := range vc.GetVolumes("hello.proc.db") {
+		switch {
+		case record.InstanceNo == due[0].InstanceNo && record.State != VolumeStateArchived:
+			t.Errorf("Archived volume should be kept as archived, got %s", record)
+		case record.InstanceNo == due[1].InstanceNo && (record.State != VolumeStateFailed || record.LastError == ""):
+			t.Errorf("Failed volume should be kept with the error, got %s", record)
+		}
+	}
+
+	// the retained volumes are never due
+	vc.Release("hello.proc.db", 0, VolumeRetentionSpec{}, store)
+	if state := volumeState(vc, 1, "node1"); state != VolumeStateReleased {
+		t.Errorf("Volume of the removed pod group should be released, got %q", state)
+	}
+	if due := vc.dueRecords(time.Now().Add(time.Hour)); len(due) != 0 {
+		t.Errorf("Retained volumes should not be due, got %v", due)
+	}
+	if err := vc.Clean("hello.proc.db", 1, "node1", store); err != nil {
+		t.Errorf("Released volume should be cleaned, got %s", err)
+	}
+	if due := vc.dueRecords(time.Now()); len(due) != 1 || due[0].InstanceNo != 1 {
+		t.Errorf("Cleaned volume should be due right away, got %v", due)
+	}
+}
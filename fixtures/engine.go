@@ -47,7 +47,7 @@ func main() {
 	pgSpec := engine.NewPodGroupSpec("hello.proc.web.foo", "hello", engine.NewPodSpec(containerSpec), 1)
 	pgSpec.RestartPolicy = engine.RestartPolicyAlways
 
-	err = orcEngine.NewPodGroup(pgSpec)
+	_, err = orcEngine.NewPodGroup(pgSpec)
 	if err != nil {
 		panic(fmt.Sprintf("Fail to create new pod group, %s", err))
 	}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"runtime"
@@ -22,9 +23,9 @@ const (
 )
 
 func main() {
-	var webAddr, swarmAddr, etcdAddr, advertise string
+	var webAddr, swarmAddr, etcdAddr, advertise, schedulerStrategy, helperImage, volumeHelperImage, secretKeyFile string
 	var isDebug, version bool
-	var refreshInterval, dependsGCTime, maxRestartTimes, restartInfoClearInterval int
+	var refreshInterval, dependsGCTime, maxRestartTimes, restartInfoClearInterval, revisionHistoryLimit int
 
 	flag.StringVar(&advertise, "advertise", "", "The address advertise to other peers, this will open HA mode")
 	flag.StringVar(&webAddr, "web", ":9000", "The address which lain-deployd is listenning on")
@@ -34,6 +35,11 @@ func main() {
 	flag.IntVar(&refreshInterval, "refreshInterval", 90, "The refresh interval time (seconds)")
 	flag.IntVar(&maxRestartTimes, "maxRestartTimes", 3, "The max restart times for pod")
 	flag.IntVar(&restartInfoClearInterval, "restartInfoClearInterval", 30, "The interval to clear restart info (minutes)")
+	flag.IntVar(&revisionHistoryLimit, "revisionHistoryLimit", 10, "The max number of spec revisions kept for each pod group")
+	flag.StringVar(&schedulerStrategy, "scheduler", "", "The strategy to place the instances, spread or binpack, empty to leave it to swarm")
+	flag.StringVar(&helperImage, "helperImage", "busybox", "The image of the helper containers which clean the volumes and render the configs")
+	flag.StringVar(&volumeHelperImage, "volumeHelperImage", "", "Deprecated, the same as -helperImage")
+	flag.StringVar(&secretKeyFile, "secretKeyFile", "", "The file of the master key to encrypt the secrets, the secrets are disabled without it")
 	flag.BoolVar(&isDebug, "debug", false, "Debug mode switch")
 	flag.BoolVar(&version, "v", false, "Show version")
 	flag.Parse()
@@ -54,6 +60,23 @@ func main() {
 	engine.RefreshInterval = refreshInterval
 	engine.RestartMaxCount = maxRestartTimes
 	engine.RestartInfoClearInterval = time.Duration(restartInfoClearInterval) * time.Minute
+	engine.RevisionHistoryLimit = revisionHistoryLimit
+	engine.SchedulerStrategy = schedulerStrategy
+	engine.HelperImage = helperImage
+	if volumeHelperImage != "" {
+		helperImageSet := false
+		flag.Visit(func(f *flag.Flag) { helperImageSet = helperImageSet || f.Name == "helperImage" })
+		if !helperImageSet {
+			engine.HelperImage = volumeHelperImage
+		}
+	}
+	if secretKeyFile != "" {
+		key, err := ioutil.ReadFile(secretKeyFile)
+		if err != nil {
+			log.Fatalf("Cannot read the secret key file, %s", err)
+		}
+		engine.SecretMasterKey = []byte(strings.TrimSpace(string(key)))
+	}
 
 	server := apiserver.New(swarmAddr, etcdAddr, isDebug)
 
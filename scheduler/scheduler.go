@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/laincloud/deployd/cluster"
+)
+
+var (
+	ErrNoNodeAvailable = errors.New("No node is available for the instance")
+	ErrUnknownStrategy = errors.New("Unknown scheduling strategy")
+)
+
+// Constraint is the same as the swarm constraint filter, the key "node" is the node name and the others
+// are the engine labels of the node
+type Constraint struct {
+	Key   string
+	Equal bool
+	Value string
+	Soft  bool
+}
+
+// Match checks the constraint against the node, it is passed if the labels of the node are unknown
+func (c Constraint) Match(node cluster.Node) bool {
+	target := node.Name
+	if c.Key != "node" {
+		if node.Labels == nil {
+			return true
+		}
+		target = node.Labels[c.Key]
+	}
+	matched := c.Value == target
+	if !matched {
+		matched, _ = path.Match(c.Value, target)
+	}
+	return matched == c.Equal
+}
+
+// Request describes the instance to be placed
+type Request struct {
+	Name        string // the pod group name
+	InstanceNo  int
+	CPUs        int
+	Memory      int64
+	PinnedNode  string         // stateful instances should stay on their node
+	Placements  map[string]int // the number of instances of the pod group on each node
+	Constraints []Constraint
+	Exclusive   bool // the instance binds fixed host ports, the nodes in Placements cannot be used
+
+	// the instance count difference between the domains should not exceed MaxSkew if it is set
+	Domains map[string]string // node name to the domain, e.g. the rack
+	MaxSkew int
+}
+
+// NodeScore explains why the node is chosen or not
+type NodeScore struct {
+	Node     string
+	Score    float64
+	Filtered bool
+	Reason   string
+}
+
+type Decision struct {
+	Node     string
+	Strategy string
+	Scores   []NodeScore
+}
+
+// Strategy scores the nodes which pass the filters, the node with the highest score is chosen
+type Strategy interface {
+	Score(node cluster.Node, req Request) float64
+}
+
+var (
+	strategiesLock sync.RWMutex
+	strategies     = map[string]Strategy{
+		"spread":  SpreadStrategy{},
+		"binpack": BinpackStrategy{},
+	}
+)
+
+// Register adds a new strategy, the existing one with the same name is replaced
+func Register(name string, strategy Strategy) {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	strategies[name] = strategy
+}
+
+type Scheduler struct {
+	name     string
+	strategy Strategy
+}
+
+func New(strategyName string) (*Scheduler, error) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	if strategy, ok := strategies[strategyName]; !ok {
+		return nil, ErrUnknownStrategy
+	} else {
+		return &Scheduler{strategyName, strategy}, nil
+	}
+}
+
+func (s *Scheduler) String() string {
+	return fmt.Sprintf("<Scheduler strategy=%s>", s.name)
+}
+
+// Schedule chooses a node for the instance, the scores of all the nodes are returned for the explanation
+func (s *Scheduler) Schedule(nodes []cluster.Node, req Request) (Decision, error) {
+	decision := Decision{Strategy: s.name}
+	best := -1
+	domainCounts := countDomains(nodes, req)
+	for _, node := range nodes {
+		score := NodeScore{Node: node.Name}
+		if reason, ok := filterNode(node, req); !ok {
+			score.Filtered = true
+			score.Reason = reason
+		} else if reason, ok := filterDomain(node, req, domainCounts); !ok {
+			score.Filtered = true
+			score.Reason = reason
+		} else {
+			score.Score = s.strategy.Score(node, req)
+		}
+		decision.Scores = append(decision.Scores, score)
+	}
+	sort.Sort(byScore(decision.Scores))
+	for i, score := range decision.Scores {
+		if !score.Filtered {
+			best = i
+			break
+		}
+	}
+	if best < 0 {
+		return decision, ErrNoNodeAvailable
+	}
+	decision.Node = decision.Scores[best].Node
+	return decision, nil
+}
+
+func filterNode(node cluster.Node, req Request) (string, bool) {
+	if req.PinnedNode != "" && node.Name != req.PinnedNode {
+		return fmt.Sprintf("instance is pinned to node %s", req.PinnedNode), false
+	}
+	if req.Exclusive && req.Placements[node.Name] > 0 {
+		return "host ports are taken by another instance", false
+	}
+	for _, c := range req.Constraints {
+		if !c.Soft && !c.Match(node) {
+			return fmt.Sprintf("blocked by constraint %s", c), false
+		}
+	}
+	if req.CPUs > 0 && node.SpareCPUs() < req.CPUs {
+		return fmt.Sprintf("not enough cpus, spare=%d, need=%d", node.SpareCPUs(), req.CPUs), false
+	}
+	if req.Memory > 0 && node.SpareMemory() < req.Memory {
+		return fmt.Sprintf("not enough memory, spare=%d, need=%d", node.SpareMemory(), req.Memory), false
+	}
+	return "", true
+}
+
+// countDomains counts the instances of each domain, the domains of the nodes without instances are counted as 0
+func countDomains(nodes []cluster.Node, req Request) map[string]int {
+	if req.MaxSkew <= 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, node := range nodes {
+		if domain, ok := req.Domains[node.Name]; ok {
+			counts[domain] += 0
+		}
+	}
+	for nodeName, count := range req.Placements {
+		if domain, ok := req.Domains[nodeName]; ok {
+			counts[domain] += count
+		}
+	}
+	return counts
+}
+
+func filterDomain(node cluster.Node, req Request, counts map[string]int) (string, bool) {
+	if req.MaxSkew <= 0 {
+		return "", true
+	}
+	domain, ok := req.Domains[node.Name]
+	if !ok {
+		return "node has no topology domain", false
+	}
+	min := counts[domain]
+	for _, count := range counts {
+		if count < min {
+			min = count
+		}
+	}
+	if skew := counts[domain] + 1 - min; skew > req.MaxSkew {
+		return fmt.Sprintf("skew of domain %s would be %d, max=%d", domain, skew, req.MaxSkew), false
+	}
+	return "", true
+}
+
+func (c Constraint) String() string {
+	operator := "=="
+	if !c.Equal {
+		operator = "!="
+	}
+	if c.Soft {
+		operator += "~"
+	}
+	return fmt.Sprintf("%s%s%s", c.Key, operator, c.Value)
+}
+
+// byScore sorts the available nodes first by the score, then the node name to keep the decision stable
+type byScore []NodeScore
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Filtered != s[j].Filtered {
+		return !s[i].Filtered
+	}
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].Node < s[j].Node
+}
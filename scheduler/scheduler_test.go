@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/laincloud/deployd/cluster"
+)
+
+func testNodes() []cluster.Node {
+	return []cluster.Node{
+		{Name: "node1", CPUs: 8, UsedCPUs: 6, Memory: 8000, UsedMemory: 6000},
+		{Name: "node2", CPUs: 8, UsedCPUs: 2, Memory: 8000, UsedMemory: 2000},
+		{Name: "node3", CPUs: 8, UsedCPUs: 4, Memory: 8000, UsedMemory: 4000},
+	}
+}
+
+func mustSchedule(t *testing.T, strategy string, req Request) string {
+	s, err := New(strategy)
+	if err != nil {
+		t.Fatalf("Cannot create scheduler %q, %s", strategy, err)
+	}
+	decision, err := s.Schedule(testNodes(), req)
+	if err != nil {
+		t.Fatalf("Cannot schedule %+v, %s, scores=%+v", req, err, decision.Scores)
+	}
+	return decision.Node
+}
+
+func TestSpread(t *testing.T) {
+	if node := mustSchedule(t, "spread", Request{CPUs: 1, Memory: 1000}); node != "node2" {
+		t.Errorf("Spread should choose the idle node, got %s", node)
+	}
+	req := Request{CPUs: 1, Memory: 1000, Placements: map[string]int{"node2": 1}}
+	if node := mustSchedule(t, "spread", req); node != "node3" {
+		t.Errorf("Spread should keep the instances apart, got %s", node)
+	}
+}
+
+func TestBinpack(t *testing.T) {
+	if node := mustSchedule(t, "binpack", Request{CPUs: 1, Memory: 1000}); node != "node1" {
+		t.Errorf("Binpack should choose the busy node, got %s", node)
+	}
+	if node := mustSchedule(t, "binpack", Request{CPUs: 3, Memory: 3000}); node != "node3" {
+		t.Errorf("Binpack should choose the busy node which still fits, got %s", node)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	req := Request{PinnedNode: "node1"}
+	if node := mustSchedule(t, "spread", req); node != "node1" {
+		t.Errorf("Pinned instance should stay on node1, got %s", node)
+	}
+	req = Request{Constraints: []Constraint{{Key: "node", Equal: false, Value: "node2"}}}
+	if node := mustSchedule(t, "spread", req); node != "node3" {
+		t.Errorf("Constraint should block node2, got %s", node)
+	}
+	req = Request{Constraints: []Constraint{{Key: "node", Equal: false, Value: "node2", Soft: true}}}
+	if node := mustSchedule(t, "spread", req); node != "node2" {
+		t.Errorf("Soft constraint should not block node2, got %s", node)
+	}
+	req = Request{Constraints: []Constraint{{Key: "node", Equal: true, Value: "node[13]"}}}
+	if node := mustSchedule(t, "spread", req); node != "node3" {
+		t.Errorf("Constraint pattern should match node1 and node3, got %s", node)
+	}
+
+	req = Request{Exclusive: true, Placements: map[string]int{"node2": 1, "node3": 1}}
+	if node := mustSchedule(t, "binpack", req); node != "node1" {
+		t.Errorf("Host ports should keep the instances on different nodes, got %s", node)
+	}
+
+	s, _ := New("spread")
+	decision, err := s.Schedule(testNodes(), Request{CPUs: 7})
+	if err != ErrNoNodeAvailable {
+		t.Errorf("Should have no node available, got %s", decision.Node)
+	}
+	for _, score := range decision.Scores {
+		if !score.Filtered || score.Reason == "" {
+			t.Errorf("Node should be filtered with a reason, got %+v", score)
+		}
+	}
+}
+
+func TestConstraintLabels(t *testing.T) {
+	node := cluster.Node{Name: "node1", Labels: map[string]string{"storage": "ssd"}}
+	tests := []struct {
+		cst   Constraint
+		match bool
+	}{
+		{Constraint{Key: "storage", Equal: true, Value: "ssd"}, true},
+		{Constraint{Key: "storage", Equal: true, Value: "s*"}, true},
+		{Constraint{Key: "storage", Equal: false, Value: "ssd"}, false},
+		{Constraint{Key: "zone", Equal: true, Value: "a"}, false},
+		{Constraint{Key: "zone", Equal: false, Value: "a"}, true},
+		{Constraint{Key: "node", Equal: true, Value: "node1"}, true},
+	}
+	for i, test := range tests {
+		if match := test.cst.Match(node); match != test.match {
+			t.Errorf("Case %d should be %v, got %v", i, test.match, match)
+		}
+	}
+	// the labels are unknown
+	if !(Constraint{Key: "storage", Equal: true, Value: "ssd"}).Match(cluster.Node{Name: "node1"}) {
+		t.Errorf("Label constraint should pass the node without the labels")
+	}
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	if _, err := New("random"); err != ErrUnknownStrategy {
+		t.Errorf("Should not create scheduler with unknown strategy, err=%v", err)
+	}
+}
+
+func TestTopologySpread(t *testing.T) {
+	domains := map[string]string{"node1": "rack1", "node2": "rack1", "node3": "rack2"}
+	req := Request{
+		Placements: map[string]int{"node2": 1},
+		Domains:    domains,
+		MaxSkew:    1,
+	}
+	if node := mustSchedule(t, "spread", req); node != "node3" {
+		t.Errorf("Topology spread should choose the empty rack, got %s", node)
+	}
+	req.Placements = map[string]int{"node2": 1, "node3": 1}
+	if node := mustSchedule(t, "spread", req); node != "node1" {
+		t.Errorf("Topology spread should allow the skew within 1, got %s", node)
+	}
+	req.PinnedNode = "node2"
+	req.Placements = map[string]int{"node2": 1}
+	s, _ := New("spread")
+	if decision, err := s.Schedule(testNodes(), req); err != ErrNoNodeAvailable {
+		t.Errorf("Topology spread should block rack1, got %s", decision.Node)
+	}
+	delete(domains, "node3")
+	req.PinnedNode = "node3"
+	if decision, err := s.Schedule(testNodes(), req); err != ErrNoNodeAvailable {
+		t.Errorf("Node without the domain should be filtered, got %s", decision.Node)
+	}
+}
+
+func TestCountDomains(t *testing.T) {
+	domains := map[string]string{"node1": "rack1", "node2": "rack1", "node3": "rack2"}
+	req := Request{
+		Placements: map[string]int{"node1": 1, "node2": 2, "node4": 1},
+		Domains:    domains,
+		MaxSkew:    1,
+	}
+	counts := countDomains(testNodes(), req)
+	if len(counts) != 2 || counts["rack1"] != 3 || counts["rack2"] != 0 {
+		t.Errorf("Should count the empty domain and skip the unknown node, got %v", counts)
+	}
+	req.MaxSkew = 0
+	if counts := countDomains(testNodes(), req); counts != nil {
+		t.Errorf("Should not count the domains without MaxSkew, got %v", counts)
+	}
+}
+
+func TestFilterDomain(t *testing.T) {
+	domains := map[string]string{"node1": "rack1", "node2": "rack2"}
+	counts := map[string]int{"rack1": 2, "rack2": 1}
+	tests := []struct {
+		node    string
+		maxSkew int
+		ok      bool
+	}{
+		{"node1", 1, false}, // rack1 would be 3 against 1
+		{"node1", 2, true},
+		{"node2", 1, true},
+		{"node3", 1, false}, // unknown domain
+		{"node3", 0, true},  // spread disabled
+	}
+	for _, test := range tests {
+		req := Request{Domains: domains, MaxSkew: test.maxSkew}
+		reason, ok := filterDomain(cluster.Node{Name: test.node}, req, counts)
+		if ok != test.ok {
+			t.Errorf("Filter node %s with MaxSkew=%d should be %v, got %v, %s", test.node, test.maxSkew, test.ok, ok, reason)
+		}
+		if !ok && reason == "" {
+			t.Errorf("Filtered node %s should have a reason", test.node)
+		}
+	}
+}
+
+func TestTopologySpreadFilteredDomain(t *testing.T) {
+	// the only node of rack2 has no room, but rack2 still counts so rack1 cannot take another instance
+	req := Request{
+		CPUs:       3,
+		Placements: map[string]int{"node2": 1},
+		Domains:    map[string]string{"node1": "rack2", "node2": "rack1", "node3": "rack1"},
+		MaxSkew:    1,
+	}
+	s, _ := New("spread")
+	decision, err := s.Schedule(testNodes(), req)
+	if err != ErrNoNodeAvailable {
+		t.Errorf("Should not break the skew when the empty domain is full, got %s", decision.Node)
+	}
+	for _, score := range decision.Scores {
+		if !score.Filtered {
+			t.Errorf("Node should be filtered, got %+v", score)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"github.com/laincloud/deployd/cluster"
+)
+
+// resourceRatio is the used ratio of the node resources after placing the instance, from 0 to 1
+func resourceRatio(node cluster.Node, req Request) float64 {
+	var ratio float64
+	count := 0
+	if node.CPUs > 0 {
+		ratio += float64(node.UsedCPUs+req.CPUs) / float64(node.CPUs)
+		count += 1
+	}
+	if node.Memory > 0 {
+		ratio += float64(node.UsedMemory+req.Memory) / float64(node.Memory)
+		count += 1
+	}
+	if count == 0 {
+		return 0
+	}
+	return ratio / float64(count)
+}
+
+// SpreadStrategy prefers the nodes with fewer instances of the same pod group, then the idle nodes
+type SpreadStrategy struct{}
+
+func (s SpreadStrategy) Score(node cluster.Node, req Request) float64 {
+	return -float64(req.Placements[node.Name])*10 + (1 - resourceRatio(node, req))
+}
+
+// BinpackStrategy prefers the busy nodes to leave the idle nodes for the big instances,
+// the instances of the same pod group are still kept apart if the nodes are equally busy
+type BinpackStrategy struct{}
+
+func (s BinpackStrategy) Score(node cluster.Node, req Request) float64 {
+	return resourceRatio(node, req)*10 - float64(req.Placements[node.Name])*0.1
+}
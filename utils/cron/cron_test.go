@@ -0,0 +1,66 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04"
+
+func assertNext(t *testing.T, expr string, from string, expected string) {
+	s, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Cannot parse %q, %s", expr, err)
+	}
+	start, _ := time.Parse(timeLayout, from)
+	next := s.Next(start)
+	if actual := next.Format(timeLayout); actual != expected {
+		t.Errorf("Next of %q from %s: expected %s, got %s", expr, from, expected, actual)
+	}
+}
+
+func TestNext(t *testing.T) {
+	assertNext(t, "* * * * *", "2016-06-01 10:00", "2016-06-01 10:01")
+	assertNext(t, "*/15 * * * *", "2016-06-01 10:07", "2016-06-01 10:15")
+	assertNext(t, "30 2 * * *", "2016-06-01 10:00", "2016-06-02 02:30")
+	assertNext(t, "0 9-17/4 * * *", "2016-06-01 13:00", "2016-06-01 17:00")
+	assertNext(t, "0 0 1 * *", "2016-12-15 00:00", "2017-01-01 00:00")
+	assertNext(t, "0 0 * * 0", "2016-06-01 00:00", "2016-06-05 00:00")
+	assertNext(t, "0 0 * * 7", "2016-06-01 00:00", "2016-06-05 00:00")
+	assertNext(t, "0 0 29 2 *", "2016-03-01 00:00", "2020-02-29 00:00")
+	assertNext(t, "0 0 15 * 1", "2016-06-01 00:00", "2016-06-06 00:00")
+	assertNext(t, "5,10 1 * * *", "2016-06-01 01:05", "2016-06-01 01:10")
+	assertNext(t, "@hourly", "2016-06-01 10:30", "2016-06-01 11:00")
+	assertNext(t, "@daily", "2016-06-01 10:30", "2016-06-02 00:00")
+}
+
+func TestNoMatch(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Cannot parse, %s", err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Should never match, got %s", next)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	invalids := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@often",
+	}
+	for _, expr := range invalids {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Should not parse %q", expr)
+		}
+	}
+}